@@ -0,0 +1,64 @@
+package abis
+
+const CoinbaseSmartWalletAbi = `[
+    {
+        "type": "function",
+        "name": "execute",
+        "inputs": [
+            { "name": "target", "type": "address", "internalType": "address" },
+            { "name": "value", "type": "uint256", "internalType": "uint256" },
+            { "name": "data", "type": "bytes", "internalType": "bytes" }
+        ],
+        "outputs": [],
+        "stateMutability": "payable"
+    },
+    {
+        "type": "function",
+        "name": "executeBatch",
+        "inputs": [
+            {
+                "name": "calls",
+                "type": "tuple[]",
+                "internalType": "struct CoinbaseSmartWallet.Call[]",
+                "components": [
+                    { "name": "target", "type": "address", "internalType": "address" },
+                    { "name": "value", "type": "uint256", "internalType": "uint256" },
+                    { "name": "data", "type": "bytes", "internalType": "bytes" }
+                ]
+            }
+        ],
+        "outputs": [],
+        "stateMutability": "payable"
+    },
+    {
+        "type": "function",
+        "name": "ownerAtIndex",
+        "inputs": [
+            { "name": "index", "type": "uint256", "internalType": "uint256" }
+        ],
+        "outputs": [
+            { "name": "", "type": "bytes", "internalType": "bytes" }
+        ],
+        "stateMutability": "view"
+    },
+    {
+        "type": "function",
+        "name": "nextOwnerIndex",
+        "inputs": [],
+        "outputs": [
+            { "name": "", "type": "uint256", "internalType": "uint256" }
+        ],
+        "stateMutability": "view"
+    },
+    {
+        "type": "function",
+        "name": "replaySafeHash",
+        "inputs": [
+            { "name": "hash", "type": "bytes32", "internalType": "bytes32" }
+        ],
+        "outputs": [
+            { "name": "", "type": "bytes32", "internalType": "bytes32" }
+        ],
+        "stateMutability": "view"
+    }
+]`
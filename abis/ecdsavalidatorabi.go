@@ -0,0 +1,25 @@
+package abis
+
+const EcdsaValidatorErrorsAbi = `[
+    {
+        "type": "error",
+        "name": "AlreadyInitialized",
+        "inputs": [
+            { "name": "smartAccount", "type": "address", "internalType": "address" }
+        ]
+    },
+    {
+        "type": "error",
+        "name": "NotInitialized",
+        "inputs": [
+            { "name": "smartAccount", "type": "address", "internalType": "address" }
+        ]
+    },
+    {
+        "type": "error",
+        "name": "InvalidTargetAddress",
+        "inputs": [
+            { "name": "target", "type": "address", "internalType": "address" }
+        ]
+    }
+]`
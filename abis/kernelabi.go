@@ -0,0 +1,128 @@
+package abis
+
+const KernelErrorsAbi = `[
+    {
+        "type": "error",
+        "name": "EnableNotApproved",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "ExecutionReverted",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidCallType",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidCaller",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidExecutor",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidFallback",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidMode",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidNonce",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidSelector",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidSignature",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidValidationType",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InvalidValidator",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "NonceInvalidationError",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "NotSupportedCallType",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "OnlyExecuteUserOp",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "PermissionDataLengthMismatch",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "PermissionNotAlllowedForSignature",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "PermissionNotAlllowedForUserOp",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "PolicyDataTooLarge",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "PolicySignatureOrderError",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "RootValidatorCannotBeRemoved",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "SignerPrefixNotPresent",
+        "inputs": []
+    },
+    {
+        "type": "error",
+        "name": "InitConfigError",
+        "inputs": [
+            { "name": "idx", "type": "uint256", "internalType": "uint256" }
+        ]
+    },
+    {
+        "type": "error",
+        "name": "PolicyFailed",
+        "inputs": [
+            { "name": "i", "type": "uint256", "internalType": "uint256" }
+        ]
+    }
+]`
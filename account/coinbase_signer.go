@@ -0,0 +1,401 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"github.com/DIMO-Network/go-zerodev/abis"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	signer "github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"strings"
+)
+
+const coinbaseMessageType = "CoinbaseSmartWalletMessage(bytes32 hash)"
+
+var (
+	signatureWrapperArgs = abi.Arguments{
+		{Type: mustTupleType([]abi.ArgumentMarshaling{
+			{Name: "ownerIndex", Type: "uint256"},
+			{Name: "signatureData", Type: "bytes"},
+		})},
+	}
+
+	webAuthnAuthArgs = abi.Arguments{
+		{Type: mustTupleType([]abi.ArgumentMarshaling{
+			{Name: "authenticatorData", Type: "bytes"},
+			{Name: "clientDataJSON", Type: "string"},
+			{Name: "challengeIndex", Type: "uint256"},
+			{Name: "typeIndex", Type: "uint256"},
+			{Name: "r", Type: "uint256"},
+			{Name: "s", Type: "uint256"},
+		})},
+	}
+
+	// p256N is the order of the secp256r1 curve, WebAuthn signatures with s > n/2 are rejected on-chain
+	p256N, _  = new(big.Int).SetString("FFFFFFFF00000000FFFFFFFFFFFFFFFFBCE6FAADA7179E84F3B9CAC2FC632551", 16)
+	p256HalfN = new(big.Int).Rsh(p256N, 1)
+
+	coinbaseAbi = mustParseAbi(abis.CoinbaseSmartWalletAbi)
+)
+
+var ErrCoinbaseOwnerNotFound = errors.New("owner is not registered on the coinbase smart wallet")
+
+// CoinbaseOwner is one of the owners of a Coinbase Smart Wallet.
+// It produces the signatureData part of the SignatureWrapper for the given hash.
+type CoinbaseOwner interface {
+	// OwnerBytes returns the owner as stored by the wallet: abi.encode(address) for ECDSA owners, abi.encode(x, y) for WebAuthn owners
+	OwnerBytes() []byte
+	SignatureData(hash common.Hash) ([]byte, error)
+}
+
+// CoinbaseEcdsaOwner is an EOA owner of a Coinbase Smart Wallet
+type CoinbaseEcdsaOwner struct {
+	PrivateKey *ecdsa.PrivateKey
+}
+
+func NewCoinbaseEcdsaOwner(privateKey *ecdsa.PrivateKey) *CoinbaseEcdsaOwner {
+	return &CoinbaseEcdsaOwner{
+		PrivateKey: privateKey,
+	}
+}
+
+func (o *CoinbaseEcdsaOwner) OwnerBytes() []byte {
+	return common.LeftPadBytes(crypto.PubkeyToAddress(o.PrivateKey.PublicKey).Bytes(), 32)
+}
+
+func (o *CoinbaseEcdsaOwner) SignatureData(hash common.Hash) ([]byte, error) {
+	signature, err := crypto.Sign(hash.Bytes(), o.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	signature[64] += 27
+
+	return signature, nil
+}
+
+// WebAuthnAuth is the assertion produced by a passkey, as expected by the WebAuthn library used by Coinbase Smart Wallet
+type WebAuthnAuth struct {
+	AuthenticatorData []byte
+	ClientDataJSON    string
+	ChallengeIndex    *big.Int
+	TypeIndex         *big.Int
+	R                 *big.Int
+	S                 *big.Int
+}
+
+// WebAuthnAuthenticator requests an assertion over the given challenge from a passkey
+type WebAuthnAuthenticator interface {
+	Authenticate(challenge []byte) (*WebAuthnAuth, error)
+}
+
+// CoinbaseWebAuthnOwner is a passkey (secp256r1) owner of a Coinbase Smart Wallet
+type CoinbaseWebAuthnOwner struct {
+	X             *big.Int
+	Y             *big.Int
+	Authenticator WebAuthnAuthenticator
+}
+
+func NewCoinbaseWebAuthnOwner(x *big.Int, y *big.Int, authenticator WebAuthnAuthenticator) *CoinbaseWebAuthnOwner {
+	return &CoinbaseWebAuthnOwner{
+		X:             x,
+		Y:             y,
+		Authenticator: authenticator,
+	}
+}
+
+func (o *CoinbaseWebAuthnOwner) OwnerBytes() []byte {
+	var buffer bytes.Buffer
+	buffer.Write(common.LeftPadBytes(o.X.Bytes(), 32))
+	buffer.Write(common.LeftPadBytes(o.Y.Bytes(), 32))
+	return buffer.Bytes()
+}
+
+func (o *CoinbaseWebAuthnOwner) SignatureData(hash common.Hash) ([]byte, error) {
+	// the wallet verifies the assertion against challenge abi.encode(hash)
+	auth, err := o.Authenticator.Authenticate(hash.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get webauthn assertion")
+	}
+
+	return EncodeWebAuthnSignatureData(auth)
+}
+
+// EncodeWebAuthnSignatureData encodes the WebAuthnAuth struct, normalizing s to the lower half of the curve order
+func EncodeWebAuthnSignatureData(auth *WebAuthnAuth) ([]byte, error) {
+	s := auth.S
+	if s.Cmp(p256HalfN) > 0 {
+		s = new(big.Int).Sub(p256N, s)
+	}
+
+	return webAuthnAuthArgs.Pack(struct {
+		AuthenticatorData []byte
+		ClientDataJSON    string
+		ChallengeIndex    *big.Int
+		TypeIndex         *big.Int
+		R                 *big.Int
+		S                 *big.Int
+	}{
+		AuthenticatorData: auth.AuthenticatorData,
+		ClientDataJSON:    auth.ClientDataJSON,
+		ChallengeIndex:    auth.ChallengeIndex,
+		TypeIndex:         auth.TypeIndex,
+		R:                 auth.R,
+		S:                 s,
+	})
+}
+
+// EncodeSignatureWrapper encodes the Coinbase Smart Wallet SignatureWrapper(ownerIndex, signatureData)
+func EncodeSignatureWrapper(ownerIndex *big.Int, signatureData []byte) ([]byte, error) {
+	return signatureWrapperArgs.Pack(struct {
+		OwnerIndex    *big.Int
+		SignatureData []byte
+	}{
+		OwnerIndex:    ownerIndex,
+		SignatureData: signatureData,
+	})
+}
+
+type CoinbaseSmartWalletSigner struct {
+	Client          types.RPCClient
+	Address         common.Address
+	OwnerIndex      *big.Int
+	Owner           CoinbaseOwner
+	AccountMetadata *AccountMetadata
+}
+
+// NewCoinbaseSmartWalletSigner creates a signer for the given owner of a Coinbase Smart Wallet.
+// When ownerIndex is nil, it is looked up on-chain on first use.
+func NewCoinbaseSmartWalletSigner(client types.RPCClient, address common.Address, ownerIndex *big.Int, owner CoinbaseOwner) (*CoinbaseSmartWalletSigner, error) {
+	if owner == nil {
+		return nil, errors.New("owner is required")
+	}
+
+	return &CoinbaseSmartWalletSigner{
+		Client:     client,
+		Address:    address,
+		OwnerIndex: ownerIndex,
+		Owner:      owner,
+	}, nil
+}
+
+func NewCoinbaseSmartWalletPrivateKeySigner(client types.RPCClient, address common.Address, ownerIndex *big.Int, privateKey *ecdsa.PrivateKey) (*CoinbaseSmartWalletSigner, error) {
+	return NewCoinbaseSmartWalletSigner(client, address, ownerIndex, NewCoinbaseEcdsaOwner(privateKey))
+}
+
+func (s *CoinbaseSmartWalletSigner) GetAddress() common.Address {
+	return s.Address
+}
+
+func (s *CoinbaseSmartWalletSigner) SignMessage(message []byte) ([]byte, error) {
+	hash := crypto.Keccak256Hash(message)
+	return s.SignHash(hash)
+}
+
+func (s *CoinbaseSmartWalletSigner) SignTypedData(typedData *signer.TypedData) ([]byte, error) {
+	hash, _, err := signer.TypedDataAndHash(*typedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.SignHash(common.BytesToHash(hash))
+}
+
+// SignHash signs the replay-safe hash of the given hash, as verified by the wallet's ERC-1271 isValidSignature
+func (s *CoinbaseSmartWalletSigner) SignHash(hash common.Hash) ([]byte, error) {
+	safeHash, err := s.ReplaySafeHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.signWrapped(safeHash)
+}
+
+// SignUserOperationHash signs the user operation hash directly, as verified by the wallet's validateUserOp
+func (s *CoinbaseSmartWalletSigner) SignUserOperationHash(hash common.Hash) ([]byte, error) {
+	return s.signWrapped(hash)
+}
+
+// ReplaySafeHash computes the EIP-712 CoinbaseSmartWalletMessage(bytes32 hash) digest bound to this wallet and chain
+func (s *CoinbaseSmartWalletSigner) ReplaySafeHash(hash common.Hash) (common.Hash, error) {
+	accountTypedData, err := s.getAccountTypedData()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	domainSeparator, err := accountTypedData.HashStruct("EIP712Domain", accountTypedData.Domain.Map())
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	args := abi.Arguments{
+		{Type: bytes32},
+		{Type: bytes32},
+	}
+
+	packed, err := args.Pack(crypto.Keccak256Hash([]byte(coinbaseMessageType)), hash)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	rawData := fmt.Sprintf("\x19\x01%s%s", string(domainSeparator), string(crypto.Keccak256(packed)))
+	return crypto.Keccak256Hash([]byte(rawData)), nil
+}
+
+func (s *CoinbaseSmartWalletSigner) signWrapped(hash common.Hash) ([]byte, error) {
+	ownerIndex, err := s.getOwnerIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	signatureData, err := s.Owner.SignatureData(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return EncodeSignatureWrapper(ownerIndex, signatureData)
+}
+
+func (s *CoinbaseSmartWalletSigner) getOwnerIndex() (*big.Int, error) {
+	if s.OwnerIndex == nil {
+		ownerIndex, err := FindCoinbaseOwnerIndex(s.Client, s.Address, s.Owner.OwnerBytes())
+		if err != nil {
+			return nil, err
+		}
+
+		s.OwnerIndex = ownerIndex
+	}
+
+	return s.OwnerIndex, nil
+}
+
+func (s *CoinbaseSmartWalletSigner) getAccountTypedData() (*signer.TypedData, error) {
+	if s.AccountMetadata == nil {
+		accountMetadata, err := GetAccountMetadata(s.Client, s.Address)
+		if err != nil {
+			return nil, err
+		}
+
+		s.AccountMetadata = accountMetadata
+	}
+
+	return &signer.TypedData{
+		Types: signer.Types{
+			"EIP712Domain": []signer.Type{
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+		},
+		Domain: signer.TypedDataDomain{
+			Name:              s.AccountMetadata.Name,
+			Version:           s.AccountMetadata.Version,
+			ChainId:           math.NewHexOrDecimal256(s.AccountMetadata.ChainId.Int64()),
+			VerifyingContract: s.AccountMetadata.VerifyingContract.String(),
+		},
+	}, nil
+}
+
+// GetCoinbaseNextOwnerIndex returns the index that will be assigned to the next owner added to the wallet
+func GetCoinbaseNextOwnerIndex(client types.RPCClient, address common.Address) (*big.Int, error) {
+	return GetCoinbaseNextOwnerIndexContext(context.Background(), client, address)
+}
+
+func GetCoinbaseNextOwnerIndexContext(ctx context.Context, client types.RPCClient, address common.Address) (*big.Int, error) {
+	result, err := callCoinbaseWallet(ctx, client, address, "nextOwnerIndex")
+	if err != nil {
+		return nil, err
+	}
+
+	return result[0].(*big.Int), nil
+}
+
+// GetCoinbaseOwnerAtIndex returns the owner bytes stored at the index, empty if the owner was removed
+func GetCoinbaseOwnerAtIndex(client types.RPCClient, address common.Address, index *big.Int) ([]byte, error) {
+	return GetCoinbaseOwnerAtIndexContext(context.Background(), client, address, index)
+}
+
+func GetCoinbaseOwnerAtIndexContext(ctx context.Context, client types.RPCClient, address common.Address, index *big.Int) ([]byte, error) {
+	result, err := callCoinbaseWallet(ctx, client, address, "ownerAtIndex", index)
+	if err != nil {
+		return nil, err
+	}
+
+	return result[0].([]byte), nil
+}
+
+// FindCoinbaseOwnerIndex looks up the index of the owner among the wallet's owners
+func FindCoinbaseOwnerIndex(client types.RPCClient, address common.Address, ownerBytes []byte) (*big.Int, error) {
+	return FindCoinbaseOwnerIndexContext(context.Background(), client, address, ownerBytes)
+}
+
+func FindCoinbaseOwnerIndexContext(ctx context.Context, client types.RPCClient, address common.Address, ownerBytes []byte) (*big.Int, error) {
+	nextOwnerIndex, err := GetCoinbaseNextOwnerIndexContext(ctx, client, address)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := big.NewInt(0); i.Cmp(nextOwnerIndex) < 0; i = new(big.Int).Add(i, big.NewInt(1)) {
+		owner, err := GetCoinbaseOwnerAtIndexContext(ctx, client, address, i)
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(owner, ownerBytes) {
+			return i, nil
+		}
+	}
+
+	return nil, ErrCoinbaseOwnerNotFound
+}
+
+func callCoinbaseWallet(ctx context.Context, client types.RPCClient, address common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	callData, err := coinbaseAbi.Pack(method, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to pack %s call data", method)
+	}
+
+	msg := struct {
+		To   common.Address `json:"to"`
+		Data hexutil.Bytes  `json:"data"`
+	}{
+		To:   address,
+		Data: callData,
+	}
+
+	var hex hexutil.Bytes
+	if err := client.CallContext(ctx, &hex, "eth_call", msg, "latest"); err != nil {
+		return nil, errors.Wrapf(err, "failed to call %s", method)
+	}
+
+	result, err := coinbaseAbi.Unpack(method, hex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to unpack %s result", method)
+	}
+
+	return result, nil
+}
+
+func mustTupleType(components []abi.ArgumentMarshaling) abi.Type {
+	tupleType, err := abi.NewType("tuple", "", components)
+	if err != nil {
+		panic(err)
+	}
+	return tupleType
+}
+
+func mustParseAbi(definition string) *abi.ABI {
+	parsedAbi, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return &parsedAbi
+}
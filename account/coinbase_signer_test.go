@@ -0,0 +1,137 @@
+package account
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoinbaseSmartWalletSigner_SignUserOperationHash(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	walletAddress := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	ownerIndex := big.NewInt(2)
+	hash := crypto.Keccak256Hash([]byte("user operation"))
+
+	s, err := NewCoinbaseSmartWalletPrivateKeySigner(&mockRPCClient{}, walletAddress, ownerIndex, privateKey)
+	require.NoError(t, err)
+
+	signature, err := s.SignUserOperationHash(hash)
+	require.NoError(t, err)
+
+	decoded, err := signatureWrapperArgs.Unpack(signature)
+	require.NoError(t, err)
+
+	wrapper := decoded[0].(struct {
+		OwnerIndex    *big.Int `json:"ownerIndex"`
+		SignatureData []byte   `json:"signatureData"`
+	})
+	assert.Equal(t, ownerIndex, wrapper.OwnerIndex)
+	require.Len(t, wrapper.SignatureData, 65)
+
+	signatureData := common.CopyBytes(wrapper.SignatureData)
+	signatureData[64] -= 27
+	publicKey, err := crypto.SigToPub(hash.Bytes(), signatureData)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.PubkeyToAddress(privateKey.PublicKey), crypto.PubkeyToAddress(*publicKey))
+}
+
+func TestCoinbaseSmartWalletSigner_ReplaySafeHash(t *testing.T) {
+	walletAddress := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+
+	s := &CoinbaseSmartWalletSigner{
+		Address: walletAddress,
+		AccountMetadata: &AccountMetadata{
+			Name:              "Coinbase Smart Wallet",
+			Version:           "1",
+			ChainId:           big.NewInt(8453),
+			VerifyingContract: walletAddress,
+		},
+	}
+
+	hash := crypto.Keccak256Hash([]byte("message"))
+	safeHash, err := s.ReplaySafeHash(hash)
+	require.NoError(t, err)
+
+	domainTypeHash := crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	domainSeparator := crypto.Keccak256(
+		domainTypeHash,
+		crypto.Keccak256([]byte("Coinbase Smart Wallet")),
+		crypto.Keccak256([]byte("1")),
+		common.LeftPadBytes(big.NewInt(8453).Bytes(), 32),
+		common.LeftPadBytes(walletAddress.Bytes(), 32),
+	)
+	structHash := crypto.Keccak256(crypto.Keccak256([]byte("CoinbaseSmartWalletMessage(bytes32 hash)")), hash.Bytes())
+	expected := crypto.Keccak256Hash([]byte{0x19, 0x01}, domainSeparator, structHash)
+
+	assert.Equal(t, expected, safeHash)
+}
+
+func TestEncodeWebAuthnSignatureData_NormalizesS(t *testing.T) {
+	highS := new(big.Int).Sub(p256N, big.NewInt(1))
+
+	encoded, err := EncodeWebAuthnSignatureData(&WebAuthnAuth{
+		AuthenticatorData: common.FromHex("0x49960de5880e8c687434170f6476605b8fe4aeb9a28632c7995cf3ba831d97630500000000"),
+		ClientDataJSON:    `{"type":"webauthn.get","challenge":"AAAA","origin":"https://keys.coinbase.com"}`,
+		ChallengeIndex:    big.NewInt(23),
+		TypeIndex:         big.NewInt(1),
+		R:                 big.NewInt(10),
+		S:                 highS,
+	})
+	require.NoError(t, err)
+
+	decoded, err := webAuthnAuthArgs.Unpack(encoded)
+	require.NoError(t, err)
+
+	normalizedS := reflect.ValueOf(decoded[0]).FieldByName("S").Interface()
+	assert.Equal(t, big.NewInt(1), normalizedS)
+}
+
+func TestFindCoinbaseOwnerIndex(t *testing.T) {
+	walletAddress := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	owners := [][]byte{
+		common.LeftPadBytes(common.HexToAddress("0x1111111111111111111111111111111111111111").Bytes(), 32),
+		{},
+		common.LeftPadBytes(common.HexToAddress("0x2222222222222222222222222222222222222222").Bytes(), 32),
+	}
+
+	mockClient := &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			data := args[0].(struct {
+				To   common.Address `json:"to"`
+				Data hexutil.Bytes  `json:"data"`
+			}).Data
+
+			abiMethod, err := coinbaseAbi.MethodById(data[:4])
+			if err != nil {
+				return err
+			}
+
+			var output []byte
+			switch abiMethod.Name {
+			case "nextOwnerIndex":
+				output, err = abiMethod.Outputs.Pack(big.NewInt(int64(len(owners))))
+			case "ownerAtIndex":
+				index, _ := abiMethod.Inputs.Unpack(data[4:])
+				output, err = abiMethod.Outputs.Pack(owners[index[0].(*big.Int).Int64()])
+			}
+			*result.(*hexutil.Bytes) = output
+			return err
+		},
+	}
+
+	index, err := FindCoinbaseOwnerIndex(mockClient, walletAddress, owners[2])
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(2), index)
+
+	_, err = FindCoinbaseOwnerIndex(mockClient, walletAddress, common.LeftPadBytes([]byte{0x33}, 32))
+	assert.ErrorIs(t, err, ErrCoinbaseOwnerNotFound)
+}
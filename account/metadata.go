@@ -22,6 +22,10 @@ type AccountMetadata struct {
 }
 
 func GetAccountMetadata(client types.RPCClient, address common.Address) (*AccountMetadata, error) {
+	return GetAccountMetadataContext(context.Background(), client, address)
+}
+
+func GetAccountMetadataContext(ctx context.Context, client types.RPCClient, address common.Address) (*AccountMetadata, error) {
 	parsedAbi, err := abi.JSON(strings.NewReader(abis.Eip1271Abi))
 	if err != nil {
 		return nil, err
@@ -41,7 +45,7 @@ func GetAccountMetadata(client types.RPCClient, address common.Address) (*Accoun
 	}
 
 	var hex hexutil.Bytes
-	if err := client.CallContext(context.Background(), &hex, "eth_call", msg, "latest"); err != nil {
+	if err := client.CallContext(ctx, &hex, "eth_call", msg, "latest"); err != nil {
 		return nil, err
 	}
 
@@ -4,12 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	ethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/friendsofgo/errors"
 	"math/big"
-	"time"
+	"strings"
 )
 
 type GasPriceSpecification struct {
@@ -47,6 +48,7 @@ type SendUserOperationRequest struct {
 	ChainID           *uint64         `json:"chainId"`
 	Operation         *UserOperation  `json:"userOp"`
 	EntryPointAddress *common.Address `json:"entryPointAddress"`
+	// Deprecated: unused, the gas token of a user operation is selected with UserOperationOptions.GasToken.
 	GasToken          *common.Address `json:"gasToken,omitempty"`
 	ShouldOverrideFee bool            `json:"shouldOverrideFee"`
 	ShouldConsume     bool            `json:"shouldConsume"`
@@ -82,6 +84,62 @@ type GetUserOperationReceiptResponse struct {
 	Success       bool                 `json:"success"`
 	Logs          []ethtypes.Log       `json:"logs"`
 	Receipt       UserOperationReceipt `json:"receipt"`
+
+	// RevertReason is decoded from the EntryPoint logs when the user operation did not succeed
+	RevertReason *UserOperationRevertReason `json:"revertReason,omitempty"`
+}
+
+// UserOperationRevertReason is emitted by the EntryPoint when the inner call (or the paymaster postOp) of a user operation reverts
+type UserOperationRevertReason struct {
+	UserOpHash   common.Hash    `json:"userOpHash"`
+	Sender       common.Address `json:"sender"`
+	Nonce        *big.Int       `json:"nonce"`
+	RevertReason hexutil.Bytes  `json:"revertReason"`
+	PostOp       bool           `json:"postOp"`
+	// Decoded is the revert reason decoded with DefaultErrorRegistry
+	Decoded *DecodedRevert `json:"decoded,omitempty"`
+}
+
+type EstimateUserOperationGasResponse struct {
+	PreVerificationGas            *big.Int `json:"preVerificationGas"`
+	VerificationGasLimit          *big.Int `json:"verificationGasLimit"`
+	CallGasLimit                  *big.Int `json:"callGasLimit"`
+	PaymasterVerificationGasLimit *big.Int `json:"paymasterVerificationGasLimit"`
+	PaymasterPostOpGasLimit       *big.Int `json:"paymasterPostOpGasLimit"`
+}
+
+type EstimateUserOperationGasResponseHex struct {
+	PreVerificationGas            string `json:"preVerificationGas"`
+	VerificationGasLimit          string `json:"verificationGasLimit"`
+	CallGasLimit                  string `json:"callGasLimit"`
+	PaymasterVerificationGasLimit string `json:"paymasterVerificationGasLimit"`
+	PaymasterPostOpGasLimit       string `json:"paymasterPostOpGasLimit"`
+}
+
+func (r *EstimateUserOperationGasResponse) UnmarshalJSON(b []byte) error {
+	var unmarshal EstimateUserOperationGasResponseHex
+	err := json.Unmarshal(b, &unmarshal)
+	if err != nil {
+		return err
+	}
+
+	*r = EstimateUserOperationGasResponse{
+		PreVerificationGas:            big.NewInt(0).SetBytes(common.FromHex(unmarshal.PreVerificationGas)),
+		VerificationGasLimit:          big.NewInt(0).SetBytes(common.FromHex(unmarshal.VerificationGasLimit)),
+		CallGasLimit:                  big.NewInt(0).SetBytes(common.FromHex(unmarshal.CallGasLimit)),
+		PaymasterVerificationGasLimit: big.NewInt(0).SetBytes(common.FromHex(unmarshal.PaymasterVerificationGasLimit)),
+		PaymasterPostOpGasLimit:       big.NewInt(0).SetBytes(common.FromHex(unmarshal.PaymasterPostOpGasLimit)),
+	}
+
+	return nil
+}
+
+type GetUserOperationByHashResponse struct {
+	UserOperation   *UserOperation `json:"userOperation"`
+	EntryPoint      common.Address `json:"entryPoint"`
+	BlockNumber     *hexutil.Big   `json:"blockNumber"`
+	BlockHash       *hexutil.Bytes `json:"blockHash"`
+	TransactionHash *hexutil.Bytes `json:"transactionHash"`
 }
 
 type BundlerClient struct {
@@ -111,48 +169,212 @@ func (b *BundlerClient) GetChainID() *big.Int {
 }
 
 func (b *BundlerClient) GetUserOperationGasPrice() (*GetUserOperationGasPriceResponse, error) {
+	return b.GetUserOperationGasPriceContext(context.Background())
+}
+
+func (b *BundlerClient) GetUserOperationGasPriceContext(ctx context.Context) (*GetUserOperationGasPriceResponse, error) {
 	var err error
 	var response GetUserOperationGasPriceResponse
 
-	err = b.Client.CallContext(context.Background(), &response, "zd_getUserOperationGasPrice")
+	err = b.Client.CallContext(ctx, &response, "zd_getUserOperationGasPrice")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to call zd_getUserOperationGasPrice")
+		return nil, newRPCError("zd_getUserOperationGasPrice", err)
 	}
 
 	return &response, nil
 }
 
 func (b *BundlerClient) SendUserOperation(op *UserOperation) ([]byte, error) {
+	return b.SendUserOperationContext(context.Background(), op)
+}
+
+func (b *BundlerClient) SendUserOperationContext(ctx context.Context, op *UserOperation) ([]byte, error) {
 	var hex hexutil.Bytes
 
-	err := b.Client.CallContext(context.Background(), &hex, "eth_sendUserOperation", op, b.EntryPoint.GetAddress())
+	err := b.Client.CallContext(ctx, &hex, "eth_sendUserOperation", op, b.EntryPoint.GetAddress())
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to call eth_sendUserOperation")
+		return nil, newRPCError("eth_sendUserOperation", err)
 	}
 
 	var response []byte = hex
 	return response, nil
 }
 
-func (b *BundlerClient) GetUserOperationReceipt(hash []byte, pollingDelaySeconds int, pollingRetries int) (*UserOperationReceipt, error) {
-	var response GetUserOperationReceiptResponse
-	ctx := context.Background()
+// GetUserOperationReceipt returns the user operation receipt, nil when the user operation is not included yet.
+// When the user operation did not succeed, the revert reason is decoded from the EntryPoint logs.
+// Use ReceiptWaiter to wait for the receipt.
+func (b *BundlerClient) GetUserOperationReceipt(hash []byte) (*GetUserOperationReceiptResponse, error) {
+	return b.GetUserOperationReceiptContext(context.Background(), hash)
+}
 
-	for i := 0; i < pollingRetries; i++ {
-		err := b.Client.CallContext(ctx, &response, "eth_getUserOperationReceipt", hexutil.Encode(hash))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to call eth_getUserOperationReceipt")
+func (b *BundlerClient) GetUserOperationReceiptContext(ctx context.Context, hash []byte) (*GetUserOperationReceiptResponse, error) {
+	var response *GetUserOperationReceiptResponse
+
+	err := b.Client.CallContext(ctx, &response, "eth_getUserOperationReceipt", hexutil.Encode(hash))
+	if err != nil {
+		return nil, newRPCError("eth_getUserOperationReceipt", err)
+	}
+
+	if response == nil || response.UserOpHash == nil {
+		return nil, nil
+	}
+
+	if !response.Success {
+		// the receipt is valid without a revert reason, logs which cannot be decoded leave it nil
+		revertReason, err := DecodeUserOperationRevertReason(response.Logs, b.EntryPoint.GetAddress())
+		if err == nil {
+			response.RevertReason = revertReason
 		}
-		if response.UserOpHash == nil {
-			time.Sleep(time.Duration(pollingDelaySeconds) * time.Second)
+	}
+
+	return response, nil
+}
+
+// entrypointRevertEvents is the parsed EntryPoint ABI the revert reason events are decoded with
+var entrypointRevertEvents = mustParseEntrypointAbi07()
+
+func mustParseEntrypointAbi07() abi.ABI {
+	parsedAbi, err := abi.JSON(strings.NewReader(entrypointAbi07))
+	if err != nil {
+		panic(err)
+	}
+	return parsedAbi
+}
+
+// DecodeUserOperationRevertReason finds the UserOperationRevertReason or PostOpRevertReason event emitted by the EntryPoint.
+// Returns nil when there is no such event in the logs, e.g. when the call ran out of gas.
+func DecodeUserOperationRevertReason(logs []ethtypes.Log, entryPoint common.Address) (*UserOperationRevertReason, error) {
+	revertEvent := entrypointRevertEvents.Events["UserOperationRevertReason"]
+	postOpRevertEvent := entrypointRevertEvents.Events["PostOpRevertReason"]
+
+	for _, log := range logs {
+		if log.Address != entryPoint || len(log.Topics) != 3 {
+			continue
+		}
+
+		var event abi.Event
+		switch log.Topics[0] {
+		case revertEvent.ID:
+			event = revertEvent
+		case postOpRevertEvent.ID:
+			event = postOpRevertEvent
+		default:
 			continue
 		}
-		break
+
+		values, err := event.Inputs.NonIndexed().Unpack(log.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to unpack %s event", event.Name)
+		}
+
+		revertReason := values[1].([]byte)
+
+		return &UserOperationRevertReason{
+			UserOpHash:   log.Topics[1],
+			Sender:       common.BytesToAddress(log.Topics[2].Bytes()),
+			Nonce:        values[0].(*big.Int),
+			RevertReason: revertReason,
+			PostOp:       event.Name == postOpRevertEvent.Name,
+			Decoded:      DefaultErrorRegistry.Decode(revertReason),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// EstimateUserOperationGas estimates gas limits of the user operation, dummy signature is used when the operation is not signed yet
+func (b *BundlerClient) EstimateUserOperationGas(op *UserOperation) (*EstimateUserOperationGasResponse, error) {
+	return b.EstimateUserOperationGasContext(context.Background(), op)
+}
+
+func (b *BundlerClient) EstimateUserOperationGasContext(ctx context.Context, op *UserOperation) (*EstimateUserOperationGasResponse, error) {
+	estimateOp := *op
+	if len(estimateOp.Signature) == 0 {
+		estimateOp.Signature = common.FromHex(SignatureDummy)
+	}
+
+	var response EstimateUserOperationGasResponse
+
+	err := b.Client.CallContext(ctx, &response, "eth_estimateUserOperationGas", &estimateOp, b.EntryPoint.GetAddress())
+	if err != nil {
+		return nil, newRPCError("eth_estimateUserOperationGas", err)
+	}
+
+	return &response, nil
+}
+
+// GetUserOperationByHash returns the user operation and the bundle transaction it was included in.
+// Returns nil when the bundler does not know the user operation.
+func (b *BundlerClient) GetUserOperationByHash(hash []byte) (*GetUserOperationByHashResponse, error) {
+	return b.GetUserOperationByHashContext(context.Background(), hash)
+}
+
+func (b *BundlerClient) GetUserOperationByHashContext(ctx context.Context, hash []byte) (*GetUserOperationByHashResponse, error) {
+	var response *GetUserOperationByHashResponse
+
+	err := b.Client.CallContext(ctx, &response, "eth_getUserOperationByHash", hexutil.Encode(hash))
+	if err != nil {
+		return nil, newRPCError("eth_getUserOperationByHash", err)
 	}
 
-	if response.UserOpHash == nil {
-		return nil, errors.New("failed to get receipt for user operation: " + hexutil.Encode(hash))
+	return response, nil
+}
+
+func (b *BundlerClient) SupportedEntryPoints() ([]common.Address, error) {
+	return b.SupportedEntryPointsContext(context.Background())
+}
+
+func (b *BundlerClient) SupportedEntryPointsContext(ctx context.Context) ([]common.Address, error) {
+	var response []common.Address
+
+	err := b.Client.CallContext(ctx, &response, "eth_supportedEntryPoints")
+	if err != nil {
+		return nil, newRPCError("eth_supportedEntryPoints", err)
+	}
+
+	return response, nil
+}
+
+func (b *BundlerClient) ChainId() (*big.Int, error) {
+	return b.ChainIdContext(context.Background())
+}
+
+func (b *BundlerClient) ChainIdContext(ctx context.Context) (*big.Int, error) {
+	var response hexutil.Big
+
+	err := b.Client.CallContext(ctx, &response, "eth_chainId")
+	if err != nil {
+		return nil, newRPCError("eth_chainId", err)
+	}
+
+	return response.ToInt(), nil
+}
+
+// CheckEntryPointAndChain verifies the bundler serves the configured chain and supports the configured EntryPoint
+func (b *BundlerClient) CheckEntryPointAndChain() error {
+	return b.CheckEntryPointAndChainContext(context.Background())
+}
+
+func (b *BundlerClient) CheckEntryPointAndChainContext(ctx context.Context) error {
+	chainID, err := b.ChainIdContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if chainID.Cmp(b.ChainID) != 0 {
+		return errors.Errorf("bundler chainID %s does not match configured chainID %s", chainID, b.ChainID)
+	}
+
+	entryPoints, err := b.SupportedEntryPointsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, entryPoint := range entryPoints {
+		if entryPoint == b.EntryPoint.GetAddress() {
+			return nil
+		}
 	}
 
-	return &response.Receipt, nil
+	return errors.Errorf("bundler does not support entrypoint %s", b.EntryPoint.GetAddress())
 }
@@ -0,0 +1,220 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockRPCClient struct {
+	callContextFunc func(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+func (m *mockRPCClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if m.callContextFunc != nil {
+		return m.callContextFunc(ctx, result, method, args...)
+	}
+	return nil
+}
+
+func (m *mockRPCClient) Close() {}
+
+// jsonResponses returns a mock answering each method with the given raw JSON result
+func jsonResponses(responses map[string]string) *mockRPCClient {
+	return &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			response, ok := responses[method]
+			if !ok {
+				return nil
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	}
+}
+
+func newTestBundlerClient(t *testing.T, rpcClient *mockRPCClient) *BundlerClient {
+	entrypoint, err := NewEntrypoint07(rpcClient, big.NewInt(ChainPolygonAmoy))
+	require.NoError(t, err)
+
+	bundlerClient, err := NewBundlerClient(rpcClient, entrypoint, big.NewInt(ChainPolygonAmoy))
+	require.NoError(t, err)
+
+	return bundlerClient
+}
+
+func TestBundlerClient_EstimateUserOperationGas(t *testing.T) {
+	bundlerClient := newTestBundlerClient(t, jsonResponses(map[string]string{
+		"eth_estimateUserOperationGas": `{"preVerificationGas":"0xd3e3","verificationGasLimit":"0x1079b","callGasLimit":"0x3f7e","paymasterVerificationGasLimit":"0x0","paymasterPostOpGasLimit":"0x0"}`,
+	}))
+
+	op := &UserOperation{Sender: common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"), Nonce: big.NewInt(1)}
+	response, err := bundlerClient.EstimateUserOperationGas(op)
+	require.NoError(t, err)
+
+	assert.Equal(t, big.NewInt(0xd3e3), response.PreVerificationGas)
+	assert.Equal(t, big.NewInt(0x1079b), response.VerificationGasLimit)
+	assert.Equal(t, big.NewInt(0x3f7e), response.CallGasLimit)
+	assert.Empty(t, op.Signature, "estimation must not modify the operation")
+}
+
+func TestBundlerClient_GetUserOperationByHash(t *testing.T) {
+	t.Run("unknown_operation", func(t *testing.T) {
+		bundlerClient := newTestBundlerClient(t, jsonResponses(map[string]string{
+			"eth_getUserOperationByHash": `null`,
+		}))
+
+		response, err := bundlerClient.GetUserOperationByHash(common.FromHex("0x01"))
+		require.NoError(t, err)
+		assert.Nil(t, response)
+	})
+
+	t.Run("included_operation", func(t *testing.T) {
+		bundlerClient := newTestBundlerClient(t, jsonResponses(map[string]string{
+			"eth_getUserOperationByHash": `{"userOperation":{"sender":"0xc81d8fa063a7c73795c8455f6b766dd245d8f47a","nonce":"0x1","callData":"0x","maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"entryPoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032","blockNumber":"0x10","blockHash":"0xaa","transactionHash":"0xbb"}`,
+		}))
+
+		response, err := bundlerClient.GetUserOperationByHash(common.FromHex("0x01"))
+		require.NoError(t, err)
+		require.NotNil(t, response)
+		assert.Equal(t, common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"), response.UserOperation.Sender)
+		assert.Equal(t, int64(16), response.BlockNumber.ToInt().Int64())
+		assert.Equal(t, common.FromHex("0xbb"), []byte(*response.TransactionHash))
+	})
+}
+
+func TestBundlerClient_CheckEntryPointAndChain(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     map[string]string
+		expectedError string
+	}{
+		{
+			name: "supported",
+			responses: map[string]string{
+				"eth_chainId":              `"0x13882"`,
+				"eth_supportedEntryPoints": `["0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789","0x0000000071727De22E5E9d8BAf0edAc6f37da032"]`,
+			},
+		},
+		{
+			name: "wrong_chain",
+			responses: map[string]string{
+				"eth_chainId":              `"0x89"`,
+				"eth_supportedEntryPoints": `["0x0000000071727De22E5E9d8BAf0edAc6f37da032"]`,
+			},
+			expectedError: "does not match configured chainID",
+		},
+		{
+			name: "unsupported_entrypoint",
+			responses: map[string]string{
+				"eth_chainId":              `"0x13882"`,
+				"eth_supportedEntryPoints": `["0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"]`,
+			},
+			expectedError: "does not support entrypoint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestBundlerClient(t, jsonResponses(tt.responses)).CheckEntryPointAndChain()
+
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBundlerClient_GetUserOperationReceipt_RevertReason(t *testing.T) {
+	entryPoint := common.HexToAddress(entryPointAddress07)
+	sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	userOpHash := common.HexToHash("0x8f3ed2fc1dac4d45b3c8d1e8b6bd7c3c5d0c1e3b9a1b5f0e4f3c8e2f1e0d9c8b")
+
+	parsedAbi, err := abi.JSON(strings.NewReader(entrypointAbi07))
+	require.NoError(t, err)
+	revertEvent := parsedAbi.Events["UserOperationRevertReason"]
+
+	// Error(string) "not allowed"
+	revertReason := common.FromHex("0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000b6e6f7420616c6c6f776564000000000000000000000000000000000000000000")
+	data, err := revertEvent.Inputs.NonIndexed().Pack(big.NewInt(7), revertReason)
+	require.NoError(t, err)
+
+	receipt := map[string]interface{}{
+		"userOpHash":    userOpHash,
+		"entrypoint":    entryPoint,
+		"sender":        sender,
+		"nonce":         "0x07",
+		"paymaster":     common.Address{},
+		"actualGasUsed": "0x1",
+		"actualGasCost": "0x1",
+		"success":       false,
+		"logs": []ethtypes.Log{{
+			Address: entryPoint,
+			Topics:  []common.Hash{revertEvent.ID, userOpHash, common.BytesToHash(sender.Bytes())},
+			Data:    data,
+		}},
+		"receipt": map[string]interface{}{},
+	}
+	encodedReceipt, err := json.Marshal(receipt)
+	require.NoError(t, err)
+
+	bundlerClient := newTestBundlerClient(t, jsonResponses(map[string]string{
+		"eth_getUserOperationReceipt": string(encodedReceipt),
+	}))
+
+	response, err := bundlerClient.GetUserOperationReceipt(userOpHash.Bytes())
+	require.NoError(t, err)
+
+	assert.False(t, response.Success)
+	require.NotNil(t, response.RevertReason)
+	assert.Equal(t, userOpHash, response.RevertReason.UserOpHash)
+	assert.Equal(t, sender, response.RevertReason.Sender)
+	assert.Equal(t, big.NewInt(7), response.RevertReason.Nonce)
+	assert.Equal(t, revertReason, []byte(response.RevertReason.RevertReason))
+	assert.False(t, response.RevertReason.PostOp)
+}
+
+func TestBundlerClient_GetUserOperationReceipt_UndecodableRevertReason(t *testing.T) {
+	entryPoint := common.HexToAddress(entryPointAddress07)
+	sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	userOpHash := common.HexToHash("0x8f3ed2fc1dac4d45b3c8d1e8b6bd7c3c5d0c1e3b9a1b5f0e4f3c8e2f1e0d9c8b")
+
+	receipt := map[string]interface{}{
+		"userOpHash":    userOpHash,
+		"entrypoint":    entryPoint,
+		"sender":        sender,
+		"nonce":         "0x07",
+		"paymaster":     common.Address{},
+		"actualGasUsed": "0x1",
+		"actualGasCost": "0x1",
+		"success":       false,
+		"logs": []ethtypes.Log{{
+			Address: entryPoint,
+			Topics:  []common.Hash{entrypointRevertEvents.Events["UserOperationRevertReason"].ID, userOpHash, common.BytesToHash(sender.Bytes())},
+			Data:    common.FromHex("0x01"),
+		}},
+		"receipt": map[string]interface{}{},
+	}
+	encodedReceipt, err := json.Marshal(receipt)
+	require.NoError(t, err)
+
+	bundlerClient := newTestBundlerClient(t, jsonResponses(map[string]string{
+		"eth_getUserOperationReceipt": string(encodedReceipt),
+	}))
+
+	response, err := bundlerClient.GetUserOperationReceipt(userOpHash.Bytes())
+	require.NoError(t, err)
+
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+	assert.Nil(t, response.RevertReason)
+}
@@ -1,37 +1,212 @@
 package zerodev
 
 import (
+	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"github.com/DIMO-Network/go-zerodev/account"
 	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/friendsofgo/errors"
 	"math/big"
+	"net/http"
 	"net/url"
+	"time"
 )
 
 type ClientConfig struct {
-	AccountAddress             common.Address
-	AccountPK                  *ecdsa.PrivateKey
-	EntryPointVersion          string
-	RpcURL                     *url.URL
-	PaymasterURL               *url.URL
-	BundlerURL                 *url.URL
-	ChainID                    *big.Int
+	AccountAddress    common.Address
+	AccountPK         *ecdsa.PrivateKey
+	EntryPointVersion string
+	RpcURL            *url.URL
+	PaymasterURL      *url.URL
+	// PaymasterType selects the protocol of the paymaster at PaymasterURL, PaymasterTypeZeroDev by default
+	PaymasterType PaymasterType
+	// PaymasterContext is passed to ERC-7677 paymasters, e.g. a sponsorship policy id
+	PaymasterContext map[string]interface{}
+	// FallbackPaymentModes are tried in order when the paymaster rejects, throttles or cannot sponsor the user operation or
+	// is down, none by default
+	FallbackPaymentModes []PaymentMode
+	// GasPriceOracle provides the fees, zd_getUserOperationGasPrice of the bundler with eth_feeHistory of RpcURL as fallback by default
+	GasPriceOracle GasPriceOracle
+	// GasPriceTier is the default gas price tier, standard when empty
+	GasPriceTier GasPriceTier
+	// MaxFeePerGas is the default ceiling of the max fee per gas, no ceiling when nil
+	MaxFeePerGas *big.Int
+	// GasLimits are the default gas limit overrides and multipliers
+	GasLimits *GasLimitOptions
+	// GasTuner adapts the call gas multiplier from receipts, disabled when nil
+	GasTuner *GasTuner
+	// SpeedUpPolicy is the default policy replacing stuck user operations, disabled when nil
+	SpeedUpPolicy *SpeedUpPolicy
+	// ManageNonces reserves the nonces of user operations with a NonceManager, so user operations of the same sender can be
+	// sent concurrently. The nonce is read from the EntryPoint for every user operation when false
+	ManageNonces bool
+	// NonceLanes is the number of nonce keys the user operations of a sender are spread over, a single one when 0 or 1
+	NonceLanes          uint64
+	BundlerURL          *url.URL
+	ChainID             *big.Int
+	ReceiptWaiterConfig ReceiptWaiterConfig
+	ReorgTrackerConfig  ReorgTrackerConfig
+	TrackerConfig       TrackerConfig
+
+	// ReceiptPollingDelaySeconds is the fixed delay between receipt polls when ReceiptWaiterConfig is not set, 10 by default.
+	//
+	// Deprecated: use ReceiptWaiterConfig.
 	ReceiptPollingDelaySeconds int
-	ReceiptPollingRetries      int
+	// ReceiptPollingRetries is the number of receipt polls when ReceiptWaiterConfig is not set, 24 by default.
+	//
+	// Deprecated: use ReceiptWaiterConfig.
+	ReceiptPollingRetries int
+}
+
+// receiptWaiterConfig returns the ReceiptWaiterConfig, or the one polling at the fixed delay of the deprecated fields
+func (c *ClientConfig) receiptWaiterConfig() ReceiptWaiterConfig {
+	if c.ReceiptWaiterConfig != (ReceiptWaiterConfig{}) || (c.ReceiptPollingDelaySeconds <= 0 && c.ReceiptPollingRetries <= 0) {
+		return c.ReceiptWaiterConfig
+	}
+
+	pollingDelaySeconds := 10
+	if c.ReceiptPollingDelaySeconds > 0 {
+		pollingDelaySeconds = c.ReceiptPollingDelaySeconds
+	}
+
+	pollingRetries := 24
+	if c.ReceiptPollingRetries > 0 {
+		pollingRetries = c.ReceiptPollingRetries
+	}
+
+	delay := time.Duration(pollingDelaySeconds) * time.Second
+	return ReceiptWaiterConfig{
+		InitialInterval: delay,
+		MaxInterval:     delay,
+		Multiplier:      1,
+		Timeout:         delay * time.Duration(pollingRetries),
+	}
+}
+
+type UserOperationStatus string
+
+const (
+	// UserOperationStatusSubmitted the user operation was accepted by the bundler and is pending in its mempool
+	UserOperationStatusSubmitted UserOperationStatus = "submitted"
+	// UserOperationStatusBundled the bundler submitted a bundle transaction containing the user operation
+	UserOperationStatusBundled UserOperationStatus = "bundled"
+	// UserOperationStatusIncluded the user operation was included on-chain and its call succeeded
+	UserOperationStatusIncluded UserOperationStatus = "included"
+	// UserOperationStatusFinalized the block including the user operation is finalized
+	UserOperationStatusFinalized UserOperationStatus = "finalized"
+	// UserOperationStatusReverted the user operation was included on-chain but its call reverted
+	UserOperationStatusReverted UserOperationStatus = "reverted"
+	// UserOperationStatusTimedOut the receipt was not available before the deadline, the user operation may still be included
+	UserOperationStatusTimedOut UserOperationStatus = "timed_out"
+	// UserOperationStatusDropped the bundler no longer knows the user operation and it was not included
+	UserOperationStatusDropped UserOperationStatus = "dropped"
+)
+
+// PaymentMode is how the gas of a user operation is paid for
+type PaymentMode string
+
+const (
+	// PaymentModeSponsored the paymaster sponsors the user operation, the default when a paymaster is configured
+	PaymentModeSponsored PaymentMode = "sponsored"
+	// PaymentModeERC20 the sender pays the token paymaster in UserOperationOptions.GasToken
+	PaymentModeERC20 PaymentMode = "erc20"
+	// PaymentModeSelfFunded the sender pays from its EntryPoint deposit and native balance, the default without a paymaster
+	PaymentModeSelfFunded PaymentMode = "self_funded"
+)
+
+// UserOperationOptions changes how a user operation created by the Client is paid for
+type UserOperationOptions struct {
+	// PaymentMode is resolved from GasToken and the configured paymaster when empty
+	PaymentMode PaymentMode
+	// GasToken makes the sender pay the paymaster in the ERC-20 token instead of being sponsored.
+	// The token paymaster is approved within the user operation when its allowance is insufficient.
+	GasToken *common.Address
+	// Sponsorship selects the gas policy of sponsored and ERC-20 paid user operations
+	Sponsorship *SponsorshipOptions
+	// GasPriceTier selects the fees of the gas price oracle, Client.GasPriceTier when empty
+	GasPriceTier GasPriceTier
+	// MaxFeePerGas is the ceiling of the max fee per gas, Client.MaxFeePerGas when nil.
+	// Preparing the user operation fails with ErrMaxFeePerGasExceeded when the oracle's fee is above it.
+	MaxFeePerGas *big.Int
+	// GasLimits overrides and scales the estimated gas limits, the fields set replace the ones of Client.GasLimits
+	GasLimits *GasLimitOptions
+	// FallbackPaymentModes are tried in order when the paymaster rejects, throttles or cannot sponsor the user operation or
+	// is down, other failures
+	// such as validation errors are returned as they are. When all payment modes fail, a *PaymentError lists their errors.
+	// Client.FallbackPaymentModes is used when nil, an empty slice disables the fallback.
+	FallbackPaymentModes []PaymentMode
+	// Resign signs a pre-signed user operation again after it was re-sponsored because its sponsorship expired before sending.
+	// Without it, sending a user operation with an expired sponsorship fails with ErrSponsorshipExpired.
+	Resign func(ctx context.Context, op *UserOperation, hash common.Hash) ([]byte, error)
+	// SponsorshipExpiryMargin is the minimal remaining validity of the sponsorship when sending, 30s by default
+	SponsorshipExpiryMargin time.Duration
+	// SpeedUp replaces the user operation with higher fees while waiting for its receipt, Client.SpeedUpPolicy when nil
+	SpeedUp *SpeedUpPolicy
+	// OrderingKey pins the user operation to the nonce lane of all user operations with the same ordering key,
+	// they are included in the order they were prepared in. Without it, the user operation may use any lane.
+	OrderingKey string
 }
 
+// SpeedUpPolicy replaces user operations pending in the bundler mempool for too long with higher fees
+type SpeedUpPolicy struct {
+	// After is how long a user operation may stay pending before it is replaced
+	After time.Duration
+	// MaxAttempts limits the number of replacements, 3 by default
+	MaxAttempts int
+	// BumpPercent is the minimal fee increase of a replacement, 10 by default which is required by most bundlers
+	BumpPercent uint64
+}
+
+// paymentMode resolves the payment mode of the options
+func (c *Client) paymentMode(options *UserOperationOptions) PaymentMode {
+	switch {
+	case options.PaymentMode != "":
+		return options.PaymentMode
+	case options.GasToken != nil:
+		return PaymentModeERC20
+	case c.PaymasterClient != nil:
+		return PaymentModeSponsored
+	default:
+		return PaymentModeSelfFunded
+	}
+}
+
+const (
+	defaultSpeedUpMaxAttempts = 3
+	defaultSpeedUpBumpPercent = 10
+)
+
+// gasTokenApprovalMarginPercent is added to the quoted token cost when approving the token paymaster
+const gasTokenApprovalMarginPercent = 20
+
+// defaultSponsorshipExpiryMargin leaves the bundler time to include the user operation before its sponsorship expires
+const defaultSponsorshipExpiryMargin = 30 * time.Second
+
+// droppedCheckTimeout bounds the lookup deciding between timed out and dropped after the receipt deadline passed
+const droppedCheckTimeout = 10 * time.Second
+
 type UserOperationResult struct {
-	UserOperationHash []byte                `json:"userOperationHash"`
-	Receipt           *UserOperationReceipt `json:"receipt,omitempty"`
+	UserOperationHash []byte                           `json:"userOperationHash"`
+	Status            UserOperationStatus              `json:"status"`
+	Receipt           *GetUserOperationReceiptResponse `json:"receipt,omitempty"`
+	// History lists the status transitions observed by the Tracker
+	History []UserOperationTransition `json:"history,omitempty"`
+	// PaymentMode is set for user operations prepared by the Client, it differs from the requested one after a fallback
+	PaymentMode PaymentMode `json:"paymentMode,omitempty"`
+	// ReplacedHashes are the hashes of the other user operations sent with the nonce of UserOperationHash, oldest first.
+	// Once included, UserOperationHash is the included one, which may be a replaced user operation.
+	ReplacedHashes [][]byte `json:"replacedHashes,omitempty"`
 }
 
 type Client struct {
 	Signer          types.AccountSigner
 	EntryPoint      Entrypoint
-	PaymasterClient *PaymasterClient
+	PaymasterClient Paymaster
 	BundlerClient   *BundlerClient
 	ChainID         *big.Int
 	RpcClients      struct {
@@ -39,73 +214,128 @@ type Client struct {
 		Paymaster *rpc.Client
 		Bundler   *rpc.Client
 	}
-	ReceiptPollingDelay   int
-	ReceiptPollingRetries int
+	// Network is RpcClients.Network, used for on-chain reads such as ERC-20 allowances
+	Network types.RPCClient
+	// FallbackPaymentModes is the default of UserOperationOptions.FallbackPaymentModes
+	FallbackPaymentModes []PaymentMode
+	// GasPriceOracle provides the fees of user operations, the bundler's zd_getUserOperationGasPrice when nil
+	GasPriceOracle GasPriceOracle
+	// GasPriceTier is the default of UserOperationOptions.GasPriceTier
+	GasPriceTier GasPriceTier
+	// MaxFeePerGas is the default of UserOperationOptions.MaxFeePerGas
+	MaxFeePerGas *big.Int
+	// GasLimits is the default of UserOperationOptions.GasLimits
+	GasLimits *GasLimitOptions
+	// GasTuner sets the call gas multiplier of user operations without one and learns from their receipts, disabled when nil
+	GasTuner *GasTuner
+	// SpeedUpPolicy is the default of UserOperationOptions.SpeedUp
+	SpeedUpPolicy *SpeedUpPolicy
+	// NonceManager reserves the nonces of user operations sent concurrently, the nonce is read from the EntryPoint for
+	// every user operation when nil
+	NonceManager *NonceManager
+	// LaneScheduler spreads the user operations of a sender over several nonce keys, a single one when nil
+	LaneScheduler *LaneScheduler
+	ReceiptWaiter *ReceiptWaiter
+	ReorgTracker  *ReorgTracker
+	Tracker       *Tracker
 }
 
-func NewClient(config *ClientConfig) (*Client, error) {
-	if config.AccountPK == nil || config.PaymasterURL == nil || config.BundlerURL == nil || config.EntryPointVersion != EntryPointVersion07 || config.ChainID == nil {
-		return nil, errors.New("accountPK, paymasterURL, bundlerURL, entryPointVersion and chainID are required")
+func NewClient(config *ClientConfig) (_ *Client, err error) {
+	if config.AccountPK == nil || config.BundlerURL == nil || config.EntryPointVersion != EntryPointVersion07 || config.ChainID == nil {
+		return nil, errors.New("accountPK, bundlerURL, entryPointVersion and chainID are required")
 	}
 
-	networkRpc, err := rpc.Dial(config.RpcURL.String())
+	var networkRpc, paymasterRpc, bundleRpc *rpc.Client
+	defer func() {
+		if err != nil {
+			closeRPCClients(networkRpc, paymasterRpc, bundleRpc)
+		}
+	}()
+
+	networkRpc, err = rpc.Dial(config.RpcURL.String())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to connect to RPC")
 	}
 
-	paymasterRpc, err := rpc.Dial(config.PaymasterURL.String())
-	if err != nil {
-		networkRpc.Close()
-		return nil, errors.Wrap(err, "failed to connect to Paymaster")
+	// without a paymaster the user operations are paid by the sender
+	if config.PaymasterURL != nil {
+		paymasterRpc, err = rpc.Dial(config.PaymasterURL.String())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to connect to Paymaster")
+		}
 	}
 
-	bundleRpc, err := rpc.Dial(config.BundlerURL.String())
+	bundleRpc, err = rpc.Dial(config.BundlerURL.String())
 	if err != nil {
-		paymasterRpc.Close()
-		networkRpc.Close()
 		return nil, errors.Wrap(err, "failed to connect to Bundler")
 	}
 
 	entrypoint, err := NewEntrypoint07(networkRpc, config.ChainID)
 	if err != nil {
-		networkRpc.Close()
-		paymasterRpc.Close()
-		networkRpc.Close()
 		return nil, errors.Wrap(err, "failed to initialize entrypoint")
 	}
 
-	paymasterClient, err := NewPaymasterClient(paymasterRpc, entrypoint, config.ChainID)
+	bundlerClient, err := NewBundlerClient(bundleRpc, entrypoint, config.ChainID)
 	if err != nil {
-		networkRpc.Close()
-		paymasterRpc.Close()
-		networkRpc.Close()
-		return nil, errors.Wrap(err, "failed to initialize paymasterClient")
+		return nil, errors.Wrap(err, "failed to initialize bundlerClient")
 	}
 
-	bundlerClient, err := NewBundlerClient(bundleRpc, entrypoint, config.ChainID)
+	var paymasterClient Paymaster
+	switch {
+	case paymasterRpc == nil:
+	case config.PaymasterType == "" || config.PaymasterType == PaymasterTypeZeroDev:
+		paymasterClient, err = NewPaymasterClient(paymasterRpc, entrypoint, config.ChainID)
+	case config.PaymasterType == PaymasterTypeERC7677:
+		paymasterClient, err = NewERC7677PaymasterClient(paymasterRpc, bundlerClient, entrypoint, config.ChainID, config.PaymasterContext)
+	default:
+		err = errors.Errorf("unsupported paymaster type: %s", config.PaymasterType)
+	}
 	if err != nil {
-		networkRpc.Close()
-		paymasterRpc.Close()
-		networkRpc.Close()
-		return nil, errors.Wrap(err, "failed to initialize bundlerClient")
+		return nil, errors.Wrap(err, "failed to initialize paymasterClient")
 	}
 
 	signer, err := account.NewSmartAccountPrivateKeySigner(networkRpc, config.AccountAddress, config.AccountPK)
 	if err != nil {
-		networkRpc.Close()
-		paymasterRpc.Close()
-		networkRpc.Close()
 		return nil, errors.Wrap(err, "failed to initialize signer")
 	}
 
-	pollingDelaySeconds := 10
-	if config.ReceiptPollingDelaySeconds > 0 {
-		pollingDelaySeconds = config.ReceiptPollingDelaySeconds
+	receiptWaiter, err := NewReceiptWaiter(bundlerClient, networkRpc, config.receiptWaiterConfig())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize receiptWaiter")
 	}
 
-	pollingRetries := 24
-	if config.ReceiptPollingRetries > 0 {
-		pollingRetries = config.ReceiptPollingRetries
+	reorgTracker, err := NewReorgTracker(bundlerClient, networkRpc, config.ReorgTrackerConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize reorgTracker")
+	}
+
+	tracker, err := NewTracker(bundlerClient, networkRpc, config.TrackerConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize tracker")
+	}
+
+	var nonceManager *NonceManager
+	if config.ManageNonces {
+		nonceManager, err = NewNonceManager(entrypoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize nonceManager")
+		}
+	}
+
+	var laneScheduler *LaneScheduler
+	if config.NonceLanes > 1 {
+		laneScheduler, err = NewLaneScheduler(config.NonceLanes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize laneScheduler")
+		}
+	}
+
+	gasPriceOracle := config.GasPriceOracle
+	if gasPriceOracle == nil {
+		gasPriceOracle, err = newDefaultGasPriceOracle(bundlerClient, networkRpc)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize gasPriceOracle")
+		}
 	}
 
 	return &Client{
@@ -123,46 +353,326 @@ func NewClient(config *ClientConfig) (*Client, error) {
 			Paymaster: paymasterRpc,
 			Bundler:   bundleRpc,
 		},
-		ReceiptPollingDelay:   pollingDelaySeconds,
-		ReceiptPollingRetries: pollingRetries,
+		Network:              networkRpc,
+		FallbackPaymentModes: config.FallbackPaymentModes,
+		GasPriceOracle:       gasPriceOracle,
+		GasPriceTier:         config.GasPriceTier,
+		MaxFeePerGas:         config.MaxFeePerGas,
+		GasLimits:            config.GasLimits,
+		GasTuner:             config.GasTuner,
+		SpeedUpPolicy:        config.SpeedUpPolicy,
+		NonceManager:         nonceManager,
+		LaneScheduler:        laneScheduler,
+		ReceiptWaiter:        receiptWaiter,
+		ReorgTracker:         reorgTracker,
+		Tracker:              tracker,
 	}, nil
 }
 
 func (c *Client) Close() {
-	c.RpcClients.Network.Close()
-	c.RpcClients.Paymaster.Close()
-	c.RpcClients.Bundler.Close()
+	closeRPCClients(c.RpcClients.Network, c.RpcClients.Paymaster, c.RpcClients.Bundler)
+}
+
+// closeRPCClients closes every client once, skipping the ones which are not connected
+func closeRPCClients(clients ...*rpc.Client) {
+	for _, client := range clients {
+		if client != nil {
+			client.Close()
+		}
+	}
 }
 
 // GetUserOperationAndHashToSign creates a UserOperation based on the sender and callData, computes its hash and returns both.
 // Allows to create UserOperation with custom sender and then customize the signing process.
-// After adding signature to the returned UserOperation, it can be sent by SendSignedUserOperation
+// After adding signature to the returned UserOperation, it can be sent by SendSignedUserOperation.
+// With a NonceManager its nonce is reserved, SendSignedUserOperation releases it when the user operation cannot be sent.
+// Release it with NonceManager.Release when the user operation is never sent.
 func (c *Client) GetUserOperationAndHashToSign(sender common.Address, callData *[]byte) (*UserOperation, *common.Hash, error) {
-	var err error
-	var op UserOperation
+	return c.GetUserOperationAndHashToSignContext(context.Background(), sender, callData)
+}
+
+// GetUserOperationAndHashToSignContext is GetUserOperationAndHashToSign using the provided context for all RPC calls.
+func (c *Client) GetUserOperationAndHashToSignContext(ctx context.Context, sender common.Address, callData *[]byte) (*UserOperation, *common.Hash, error) {
+	return c.GetUserOperationAndHashToSignWithOptionsContext(ctx, sender, callData, nil)
+}
+
+// GetUserOperationAndHashToSignWithOptions is GetUserOperationAndHashToSign with options changing how the user operation is paid for.
+// With a gas token, the call data has to be Kernel execute call data, see EncodeExecuteCall and EncodeExecuteBatchCall.
+func (c *Client) GetUserOperationAndHashToSignWithOptions(sender common.Address, callData *[]byte, options *UserOperationOptions) (*UserOperation, *common.Hash, error) {
+	return c.GetUserOperationAndHashToSignWithOptionsContext(context.Background(), sender, callData, options)
+}
 
-	nonce, err := c.EntryPoint.GetNonce(sender)
+func (c *Client) GetUserOperationAndHashToSignWithOptionsContext(ctx context.Context, sender common.Address, callData *[]byte, options *UserOperationOptions) (*UserOperation, *common.Hash, error) {
+	prepared, err := c.prepareUserOperation(ctx, sender, callData, options)
 	if err != nil {
 		return nil, nil, err
 	}
+	return prepared.Op, prepared.Hash, nil
+}
+
+// getGasPrice returns the fees of the gas price oracle for the tier of the options, enforcing the max fee per gas ceiling
+func (c *Client) getGasPrice(ctx context.Context, options *UserOperationOptions) (*GasPriceSpecification, error) {
+	oracle := c.GasPriceOracle
+	if oracle == nil {
+		oracle = &ZeroDevGasPriceOracle{Bundler: c.BundlerClient}
+	}
+
+	tier := options.GasPriceTier
+	if tier == "" {
+		tier = c.GasPriceTier
+	}
+
+	gasPrice, err := oracle.GetGasPriceContext(ctx, tier)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkMaxFeePerGas(gasPrice.MaxFeePerGas, options); err != nil {
+		return nil, err
+	}
+
+	return gasPrice, nil
+}
+
+// checkMaxFeePerGas fails when the max fee per gas is above the ceiling of the options, the Client's one by default
+func (c *Client) checkMaxFeePerGas(maxFeePerGas *big.Int, options *UserOperationOptions) error {
+	ceiling := options.MaxFeePerGas
+	if ceiling == nil {
+		ceiling = c.MaxFeePerGas
+	}
+
+	if ceiling != nil && maxFeePerGas.Cmp(ceiling) > 0 {
+		return errors.Wrapf(ErrMaxFeePerGasExceeded, "max fee per gas %s, ceiling %s", maxFeePerGas, ceiling)
+	}
+
+	return nil
+}
+
+// gasLimitOptions merges the gas limit options of the client and the user operation.
+// Without a call gas override or multiplier, the call gas multiplier of the GasTuner is used when it knows the calls.
+func (c *Client) gasLimitOptions(options *UserOperationOptions, callData []byte) *GasLimitOptions {
+	gasLimits := c.GasLimits.merge(options.GasLimits)
+
+	if c.GasTuner == nil || (gasLimits != nil && (gasLimits.CallGasLimit != nil || gasLimits.CallGasMultiplierPercent != 0)) {
+		return gasLimits
+	}
+
+	percent, ok := c.GasTuner.CallGasMultiplierPercent(callData)
+	if !ok {
+		return gasLimits
+	}
+
+	return gasLimits.merge(&GasLimitOptions{CallGasMultiplierPercent: percent})
+}
+
+// withGasLimits returns the options with the gas limits set in the sponsorship options, the paymaster adjusts them before signing
+func withGasLimits(options *UserOperationOptions, gasLimits *GasLimitOptions) *UserOperationOptions {
+	if gasLimits == nil {
+		return options
+	}
+
+	sponsorship := SponsorshipOptions{}
+	if options.Sponsorship != nil {
+		sponsorship = *options.Sponsorship
+	}
+	sponsorship.GasLimits = gasLimits
+
+	adjustedOptions := *options
+	adjustedOptions.Sponsorship = &sponsorship
+	return &adjustedOptions
+}
+
+// preparedUserOperation is a user operation ready to be signed
+type preparedUserOperation struct {
+	Op          *UserOperation
+	Hash        *common.Hash
+	PaymentMode PaymentMode
+	// GasLimits are the gas limit options applied to the estimate
+	GasLimits *GasLimitOptions
+}
+
+// prepareUserOperation creates the user operation and returns it with its hash and the payment mode it is paid with.
+// When paying with the resolved payment mode fails, the fallback payment modes are tried in order.
+// The nonce reserved for the user operation is released when preparing it fails.
+func (c *Client) prepareUserOperation(ctx context.Context, sender common.Address, callData *[]byte, options *UserOperationOptions) (prepared *preparedUserOperation, err error) {
+	var op UserOperation
+
+	if options == nil {
+		options = &UserOperationOptions{}
+	}
+
+	nonce, err := c.reserveNonce(ctx, sender, options)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			c.releaseNonce(sender, nonce)
+		}
+	}()
 
 	op.Sender = sender
 	op.Nonce = nonce
 	op.CallData = *callData
 
-	gasPrice, err := c.BundlerClient.GetUserOperationGasPrice()
+	gasPrice, err := c.getGasPrice(ctx, options)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	op.MaxFeePerGas = gasPrice.MaxFeePerGas
+	op.MaxPriorityFeePerGas = gasPrice.MaxPriorityFeePerGas
+
+	fallbackModes := options.FallbackPaymentModes
+	if fallbackModes == nil {
+		fallbackModes = c.FallbackPaymentModes
 	}
 
-	op.MaxFeePerGas = gasPrice.Standard.MaxFeePerGas
-	op.MaxPriorityFeePerGas = gasPrice.Standard.MaxPriorityFeePerGas
+	gasLimits := c.gasLimitOptions(options, op.CallData)
+	options = withGasLimits(options, gasLimits)
 
-	sponsorResponse, err := c.PaymasterClient.SponsorUserOperation(&op)
+	var paidOp *UserOperation
+	var mode PaymentMode
+	paymentErr := &PaymentError{}
+	for _, candidate := range append([]PaymentMode{c.paymentMode(options)}, fallbackModes...) {
+		// every payment mode starts from the same user operation, e.g. paying in tokens may prepend an approve call
+		attempt := op
+
+		payErr := c.payUserOperation(ctx, &attempt, candidate, options)
+		if payErr == nil {
+			paidOp = &attempt
+			mode = candidate
+			break
+		}
+
+		paymentErr.Modes = append(paymentErr.Modes, candidate)
+		paymentErr.Errors = append(paymentErr.Errors, payErr)
+
+		// only a rejected or unavailable sponsorship is paid differently, other failures would fail again
+		if ctx.Err() != nil || !isSponsorshipRejection(payErr) {
+			break
+		}
+	}
+	if paidOp == nil {
+		if len(paymentErr.Errors) == 1 {
+			return nil, paymentErr.Errors[0]
+		}
+		return nil, paymentErr
+	}
+
+	opHash, err := c.EntryPoint.GetUserOperationHash(paidOp)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	return &preparedUserOperation{
+		Op:          paidOp,
+		Hash:        opHash,
+		PaymentMode: mode,
+		GasLimits:   gasLimits,
+	}, nil
+}
+
+// reserveNonce reserves the nonce of the sender in the lane of the options with the NonceManager,
+// or reads it from the EntryPoint without one
+func (c *Client) reserveNonce(ctx context.Context, sender common.Address, options *UserOperationOptions) (*big.Int, error) {
+	key := computeKey(sender)
+	if c.LaneScheduler != nil {
+		key = c.LaneScheduler.NonceKey(sender, options.OrderingKey)
+	}
+
+	if c.NonceManager == nil {
+		return c.EntryPoint.GetNonceWithKeyContext(ctx, sender, key)
+	}
+	return c.NonceManager.Reserve(ctx, sender, key)
+}
+
+// releaseNonce releases the nonce of a user operation which was not sent
+func (c *Client) releaseNonce(sender common.Address, nonce *big.Int) {
+	if c.NonceManager != nil {
+		c.NonceManager.Release(sender, nonce)
+	}
+}
+
+// reconcileNonce resets the nonces of the sender when the nonce of the user operation may not be free again,
+// after the EntryPoint rejected it or when it is unknown whether the bundler received the user operation
+func (c *Client) reconcileNonce(op *UserOperation) {
+	if c.NonceManager != nil && op.Nonce != nil {
+		c.NonceManager.Reset(op.Sender, nonceKey(op.Nonce))
+	}
+}
+
+// paymasterMethods are the JSON-RPC methods served by the paymaster
+var paymasterMethods = map[string]bool{
+	"zd_sponsorUserOperation":     true,
+	"stackup_getERC20TokenQuotes": true,
+	"pm_getPaymasterStubData":     true,
+	"pm_getPaymasterData":         true,
+}
+
+// isSponsorshipRejection reports whether the payment mode failed because the paymaster rejected, throttled or cannot
+// sponsor the user operation, or because the paymaster is down
+func isSponsorshipRejection(err error) bool {
+	if errors.Is(err, ErrRejectedByPaymaster) || errors.Is(err, ErrThrottledOrBanned) ||
+		errors.Is(err, ErrPaymasterNotConfigured) || errors.Is(err, ErrGasTokenNotSupported) {
+		return true
+	}
+	return isPaymasterUnavailable(err)
+}
+
+// isPaymasterUnavailable reports whether a paymaster call failed without a JSON-RPC error response,
+// i.e. on a transport error, an HTTP 5xx or an HTTP 429 response
+func isPaymasterUnavailable(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || !paymasterMethods[rpcErr.Method] || rpcErr.Code != 0 {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// payUserOperation sets the paymaster fields and the gas limits of the user operation according to the payment mode
+func (c *Client) payUserOperation(ctx context.Context, op *UserOperation, mode PaymentMode, options *UserOperationOptions) error {
+	var err error
+	var sponsorResponse *SponsorUserOperationResponse
+
+	switch mode {
+	case PaymentModeSelfFunded:
+		var gasLimits *GasLimitOptions
+		if options.Sponsorship != nil {
+			gasLimits = options.Sponsorship.GasLimits
+		}
+		sponsorResponse, err = c.estimateSelfFundedUserOperation(ctx, op, gasLimits)
+	case PaymentModeERC20:
+		if options.GasToken == nil {
+			return errors.New("gas token is required to pay in ERC-20 tokens")
+		}
+		sponsorResponse, err = c.sponsorUserOperationWithGasToken(ctx, op, *options.GasToken, options.Sponsorship)
+	case PaymentModeSponsored:
+		if c.PaymasterClient == nil {
+			return errors.Wrap(ErrPaymasterNotConfigured, "paymaster is required for sponsored user operations")
+		}
+		sponsorResponse, err = c.PaymasterClient.SponsorUserOperationWithOptionsContext(ctx, op, options.Sponsorship)
+	default:
+		return errors.Errorf("unsupported payment mode: %s", mode)
+	}
+	if err != nil {
+		return err
 	}
 
+	setSponsorship(op, sponsorResponse)
+	return nil
+}
+
+// setSponsorship sets the paymaster fields and the gas limits of the sponsorship
+func setSponsorship(op *UserOperation, sponsorResponse *SponsorUserOperationResponse) {
 	op.Paymaster = sponsorResponse.Paymaster
 	op.PaymasterData = sponsorResponse.PaymasterData
 	op.PreVerificationGas = sponsorResponse.PreVerificationGas
@@ -170,55 +680,766 @@ func (c *Client) GetUserOperationAndHashToSign(sender common.Address, callData *
 	op.PaymasterVerificationGasLimit = sponsorResponse.PaymasterVerificationGasLimit
 	op.PaymasterPostOpGasLimit = sponsorResponse.PaymasterPostOpGasLimit
 	op.CallGasLimit = sponsorResponse.CallGasLimit
+}
 
-	opHash, err := c.EntryPoint.GetUserOperationHash(&op)
+// estimateSelfFundedUserOperation estimates the gas limits of a user operation without paymaster with the bundler
+// and fails with ErrInsufficientPrefund when the EntryPoint deposit and the native balance of the sender do not cover the prefund
+func (c *Client) estimateSelfFundedUserOperation(ctx context.Context, op *UserOperation, gasLimits *GasLimitOptions) (*SponsorUserOperationResponse, error) {
+	gasEstimate, err := c.BundlerClient.EstimateUserOperationGasContext(ctx, op)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	estimatedOp := *op
+	estimatedOp.PreVerificationGas = gasEstimate.PreVerificationGas
+	estimatedOp.VerificationGasLimit = gasEstimate.VerificationGasLimit
+	estimatedOp.CallGasLimit = gasEstimate.CallGasLimit
+	gasLimits.apply(&estimatedOp)
+
+	deposit, err := c.EntryPoint.BalanceOfContext(ctx, op.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := getBalance(ctx, c.Network, op.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	required := estimatedOp.RequiredPrefund()
+	if new(big.Int).Add(deposit, balance).Cmp(required) < 0 {
+		return nil, errors.Wrapf(ErrInsufficientPrefund, "sender %s requires %s wei, has deposit %s wei and balance %s wei", op.Sender, required, deposit, balance)
 	}
 
-	return &op, opHash, nil
+	return &SponsorUserOperationResponse{
+		CallGasLimit:         estimatedOp.CallGasLimit,
+		VerificationGasLimit: estimatedOp.VerificationGasLimit,
+		PreVerificationGas:   estimatedOp.PreVerificationGas,
+		MaxPriorityFeePerGas: op.MaxPriorityFeePerGas,
+		MaxFeePerGas:         op.MaxFeePerGas,
+	}, nil
+}
+
+// sponsorUserOperationWithGasToken sponsors the user operation paid in the token.
+// When the allowance of the token paymaster does not cover the quoted cost, an approve call is prepended to the call data
+// and the user operation is sponsored again, as its gas limits changed. Fails with ErrInsufficientGasTokenApproval when
+// the user operation with the approve call costs more than the approved amount.
+func (c *Client) sponsorUserOperationWithGasToken(ctx context.Context, op *UserOperation, token common.Address, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	tokenPaymaster, ok := c.PaymasterClient.(TokenPaymaster)
+	if !ok {
+		return nil, ErrGasTokenNotSupported
+	}
+
+	sponsorResponse, err := tokenPaymaster.SponsorUserOperationWithGasTokenWithOptionsContext(ctx, op, token, options)
+	if err != nil {
+		return nil, err
+	}
+
+	quote, err := quoteSponsoredUserOperation(ctx, tokenPaymaster, op, sponsorResponse, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sponsored paymaster transfers the tokens, the quote may only name the default token paymaster
+	if len(sponsorResponse.Paymaster) == 0 {
+		return nil, errors.New("token sponsorship without paymaster")
+	}
+	spender := common.BytesToAddress(sponsorResponse.Paymaster)
+
+	allowance, err := GetERC20AllowanceContext(ctx, c.Network, token, op.Sender, spender)
+	if err != nil {
+		return nil, err
+	}
+
+	if allowance.Cmp(quote.MaxGasCostToken.ToInt()) >= 0 {
+		return sponsorResponse, nil
+	}
+
+	// the approve call makes the user operation more expensive than quoted
+	required := new(big.Int).Mul(quote.MaxGasCostToken.ToInt(), big.NewInt(100+gasTokenApprovalMarginPercent))
+	required.Div(required, big.NewInt(100))
+
+	calls, err := DecodeExecuteCall(op.CallData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepend approve call")
+	}
+
+	approveCall, err := EncodeERC20ApproveCall(token, spender, required)
+	if err != nil {
+		return nil, err
+	}
+
+	callData, err := EncodeExecuteBatchCall(append([]ethereum.CallMsg{*approveCall}, calls...))
+	if err != nil {
+		return nil, err
+	}
+	op.CallData = *callData
+
+	sponsorResponse, err = tokenPaymaster.SponsorUserOperationWithGasTokenWithOptionsContext(ctx, op, token, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(sponsorResponse.Paymaster, spender.Bytes()) {
+		return nil, errors.Errorf("token paymaster changed from %s to %s after approving it", spender, common.BytesToAddress(sponsorResponse.Paymaster))
+	}
+
+	quote, err = quoteSponsoredUserOperation(ctx, tokenPaymaster, op, sponsorResponse, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if quote.MaxGasCostToken.ToInt().Cmp(required) > 0 {
+		return nil, errors.Wrapf(ErrInsufficientGasTokenApproval, "user operation costs %s, approved %s", quote.MaxGasCostToken.ToInt(), required)
+	}
+
+	return sponsorResponse, nil
+}
+
+// quoteSponsoredUserOperation returns the token quote of the user operation with the sponsorship applied
+func quoteSponsoredUserOperation(ctx context.Context, tokenPaymaster TokenPaymaster, op *UserOperation, sponsorResponse *SponsorUserOperationResponse, token common.Address) (*ERC20TokenQuote, error) {
+	quotedOp := *op
+	setSponsorship(&quotedOp, sponsorResponse)
+
+	return tokenPaymaster.GetERC20TokenQuoteContext(ctx, &quotedOp, token)
 }
 
 // SendSignedUserOperation sends a pre-signed user operation to the bundler.
-// Allows to create UserOperation with different sender and this sender's signature
+// Allows to create UserOperation with different sender and this sender's signature.
+// When waiting for the receipt and the user operation does not reach the included status, the result is returned
+// together with a *UserOperationError wrapping ErrUserOperationReverted, ErrUserOperationTimedOut, ErrUserOperationDropped
+// or the *RPCError which prevented getting the receipt.
+// The nonce reserved with the NonceManager is released when the bundler rejects the user operation, the nonces of the
+// sender are read from the EntryPoint again when it is unknown whether the bundler received it.
 func (c *Client) SendSignedUserOperation(signedOp *UserOperation, waitForReceipt bool) (*UserOperationResult, error) {
-	response, err := c.BundlerClient.SendUserOperation(signedOp)
+	return c.SendSignedUserOperationContext(context.Background(), signedOp, waitForReceipt)
+}
+
+// SendSignedUserOperationContext is SendSignedUserOperation using the provided context for sending and receipt polling.
+func (c *Client) SendSignedUserOperationContext(ctx context.Context, signedOp *UserOperation, waitForReceipt bool) (*UserOperationResult, error) {
+	return c.SendSignedUserOperationWithOptionsContext(ctx, signedOp, waitForReceipt, nil)
+}
+
+// SendSignedUserOperationWithOptions is SendSignedUserOperation re-sponsoring the user operation when its sponsorship expires
+// within UserOperationOptions.SponsorshipExpiryMargin. The re-sponsored user operation is signed by UserOperationOptions.Resign.
+// The signed user operation passed in is left unchanged, so the sent one may differ from it in its sponsorship,
+// gas limits and signature.
+func (c *Client) SendSignedUserOperationWithOptions(signedOp *UserOperation, waitForReceipt bool, options *UserOperationOptions) (*UserOperationResult, error) {
+	return c.SendSignedUserOperationWithOptionsContext(context.Background(), signedOp, waitForReceipt, options)
+}
+
+func (c *Client) SendSignedUserOperationWithOptionsContext(ctx context.Context, signedOp *UserOperation, waitForReceipt bool, options *UserOperationOptions) (*UserOperationResult, error) {
+	if options == nil {
+		options = &UserOperationOptions{}
+	}
+
+	renewedOp, err := c.renewExpiringSponsorship(ctx, signedOp, options)
+	if err != nil {
+		c.releaseNonce(signedOp.Sender, signedOp.Nonce)
+		return nil, err
+	}
+
+	response, err := c.BundlerClient.SendUserOperationContext(ctx, renewedOp)
+	if err != nil {
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) && rpcErr.Code != 0 && !errors.Is(err, ErrAA25InvalidNonce) {
+			// the bundler rejected the user operation, its nonce is free for the next one
+			c.releaseNonce(renewedOp.Sender, renewedOp.Nonce)
+		} else {
+			// the user operation may have reached the bundler, e.g. when the request timed out
+			c.reconcileNonce(renewedOp)
+		}
+		return nil, err
+	}
+
+	result := &UserOperationResult{
+		UserOperationHash: response,
+		Status:            UserOperationStatusSubmitted,
+	}
+
+	if !waitForReceipt {
+		return result, nil
+	}
+
+	if policy := c.speedUpPolicy(options); policy != nil && policy.After > 0 {
+		if err := c.waitForUserOperationWithSpeedUp(ctx, result, options); err != nil {
+			return result, err
+		}
+		return result, nil
+	}
+
+	if err := c.waitForUserOperation(ctx, result); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// renewExpiringSponsorship returns a re-sponsored and re-signed copy of the user operation when its sponsorship expires
+// within the margin, otherwise the user operation itself. Paymaster data of unknown layouts is sent as is.
+func (c *Client) renewExpiringSponsorship(ctx context.Context, op *UserOperation, options *UserOperationOptions) (*UserOperation, error) {
+	if len(op.Paymaster) == 0 {
+		return op, nil
+	}
+
+	paymasterData, err := DecodePaymasterData(op.PaymasterData)
+	if err != nil {
+		return op, nil
+	}
+
+	margin := options.SponsorshipExpiryMargin
+	if margin <= 0 {
+		margin = defaultSponsorshipExpiryMargin
+	}
+
+	if !paymasterData.ExpiresWithin(time.Now(), margin) {
+		return op, nil
+	}
+
+	if options.Resign == nil || c.PaymasterClient == nil {
+		return nil, errors.Wrapf(ErrSponsorshipExpired, "valid until %s", time.Unix(int64(paymasterData.ValidUntil), 0).UTC())
+	}
+
+	// the caller's user operation keeps its signature until the renewed one is fully signed
+	renewed := *op
+	if err := c.responsorUserOperation(ctx, &renewed, options); err != nil {
+		return nil, errors.Wrap(err, "failed to renew expiring sponsorship")
+	}
+
+	opHash, err := c.EntryPoint.GetUserOperationHash(&renewed)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := options.Resign(ctx, &renewed, *opHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign re-sponsored user operation")
+	}
+	renewed.Signature = signature
+
+	return &renewed, nil
+}
+
+// responsorUserOperation sponsors the user operation again, e.g. after its fees changed. User operations without
+// paymaster are left as they are. The call data of ERC-20 paid user operations already approves the token paymaster,
+// only the sponsorship is renewed.
+func (c *Client) responsorUserOperation(ctx context.Context, op *UserOperation, options *UserOperationOptions) error {
+	if len(op.Paymaster) == 0 {
+		return nil
+	}
+
+	if c.PaymasterClient == nil {
+		return errors.Wrap(ErrPaymasterNotConfigured, "paymaster is required to re-sponsor user operations")
+	}
+
+	var token *common.Address
+	if paymasterData, err := DecodePaymasterData(op.PaymasterData); err == nil {
+		token = paymasterData.Token
+	}
+
+	op.Paymaster = nil
+	op.PaymasterData = nil
+	op.PaymasterVerificationGasLimit = nil
+	op.PaymasterPostOpGasLimit = nil
+
+	var err error
+	var sponsorResponse *SponsorUserOperationResponse
+	tokenPaymaster, ok := c.PaymasterClient.(TokenPaymaster)
+	if token != nil && ok {
+		sponsorResponse, err = tokenPaymaster.SponsorUserOperationWithGasTokenWithOptionsContext(ctx, op, *token, options.Sponsorship)
+	} else {
+		sponsorResponse, err = c.PaymasterClient.SponsorUserOperationWithOptionsContext(ctx, op, options.Sponsorship)
+	}
+	if err != nil {
+		return err
+	}
+
+	setSponsorship(op, sponsorResponse)
+	return nil
+}
+
+// SpeedUp replaces the pending user operation with the same one paying higher fees. The fees are raised by at least
+// SpeedUpPolicy.BumpPercent, or to the current gas price when higher, the user operation is re-sponsored, signed by
+// the Client's Signer and resubmitted with the same nonce.
+func (c *Client) SpeedUp(hash []byte) (*UserOperationResult, error) {
+	return c.SpeedUpContext(context.Background(), hash)
+}
+
+func (c *Client) SpeedUpContext(ctx context.Context, hash []byte) (*UserOperationResult, error) {
+	return c.SpeedUpWithOptionsContext(ctx, hash, nil)
+}
+
+// SpeedUpWithOptions is SpeedUp with the gas price, gas limit and sponsorship options of the replacement.
+// User operations of other senders than the Client's Signer are signed by UserOperationOptions.Resign.
+func (c *Client) SpeedUpWithOptions(hash []byte, options *UserOperationOptions) (*UserOperationResult, error) {
+	return c.SpeedUpWithOptionsContext(context.Background(), hash, options)
+}
+
+func (c *Client) SpeedUpWithOptionsContext(ctx context.Context, hash []byte, options *UserOperationOptions) (*UserOperationResult, error) {
+	pending, err := c.getPendingUserOperation(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.replaceUserOperation(ctx, hash, pending, nil, options)
+}
+
+// getPendingUserOperation returns the user operation of the hash while it is pending in the bundler mempool
+func (c *Client) getPendingUserOperation(ctx context.Context, hash []byte) (*UserOperation, error) {
+	pending, err := c.BundlerClient.GetUserOperationByHashContext(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if pending == nil || pending.UserOperation == nil {
+		return nil, errors.Wrapf(ErrUserOperationDropped, "user operation %s", hexutil.Encode(hash))
+	}
+	if pending.BlockNumber != nil {
+		return nil, errors.Wrapf(ErrUserOperationNotPending, "user operation %s included in block %s", hexutil.Encode(hash), pending.BlockNumber.ToInt())
+	}
+
+	return pending.UserOperation, nil
+}
+
+// replaceUserOperation replaces the pending user operation of the hash with one of the same nonce and higher fees,
+// executing callData instead of the original call data when set
+func (c *Client) replaceUserOperation(ctx context.Context, hash []byte, pending *UserOperation, callData []byte, options *UserOperationOptions) (*UserOperationResult, error) {
+	if options == nil {
+		options = &UserOperationOptions{}
+	}
+
+	op := *pending
+	if callData != nil {
+		op.CallData = callData
+	}
+
+	if err := c.bumpFees(ctx, &op, options); err != nil {
+		return nil, err
+	}
+
+	if err := c.responsorUserOperation(ctx, &op, withGasLimits(options, c.gasLimitOptions(options, op.CallData))); err != nil {
+		return nil, errors.Wrap(err, "failed to re-sponsor replacement user operation")
+	}
+
+	opHash, err := c.EntryPoint.GetUserOperationHash(&op)
 	if err != nil {
 		return nil, err
 	}
 
-	var receipt *UserOperationReceipt
+	switch {
+	case c.Signer != nil && op.Sender == c.Signer.GetAddress():
+		op.Signature, err = c.Signer.SignUserOperationHash(*opHash)
+	case options.Resign != nil:
+		op.Signature, err = options.Resign(ctx, &op, *opHash)
+	default:
+		return nil, errors.Errorf("no signer for sender %s", op.Sender)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign replacement user operation")
+	}
 
-	if waitForReceipt {
-		receipt, _ = c.BundlerClient.GetUserOperationReceipt(response, c.ReceiptPollingDelay, c.ReceiptPollingRetries)
+	response, err := c.BundlerClient.SendUserOperationContext(ctx, &op)
+	if err != nil {
+		return nil, err
 	}
 
 	return &UserOperationResult{
 		UserOperationHash: response,
-		Receipt:           receipt,
+		Status:            UserOperationStatusSubmitted,
+		ReplacedHashes:    [][]byte{hash},
 	}, nil
 }
 
+// CancellationOutcome tells which of a pending user operation and its cancellation was included
+type CancellationOutcome string
+
+const (
+	// CancellationOutcomeCancelled the cancellation was included, the original user operation can no longer be
+	CancellationOutcomeCancelled CancellationOutcome = "cancelled"
+	// CancellationOutcomeOriginalIncluded the original user operation was included before it could be cancelled
+	CancellationOutcomeOriginalIncluded CancellationOutcome = "original_included"
+	// CancellationOutcomePending neither was included yet, either one may still be
+	CancellationOutcomePending CancellationOutcome = "pending"
+	// CancellationOutcomeInvalidated the nonce invalidation was included, no pending user operation was replaced
+	CancellationOutcomeInvalidated CancellationOutcome = "invalidated"
+)
+
+// CancellationResult reports the outcome of cancelling a pending user operation
+type CancellationResult struct {
+	// OriginalHash is the hash of the cancelled user operation, nil when nothing was replaced
+	OriginalHash []byte `json:"originalHash,omitempty"`
+	// Cancellation is the result of the cancelling user operation, nil when the original was included before it was sent
+	Cancellation *UserOperationResult `json:"cancellation,omitempty"`
+	Outcome      CancellationOutcome  `json:"outcome"`
+	// Receipt is the receipt of the included user operation
+	Receipt *GetUserOperationReceiptResponse `json:"receipt,omitempty"`
+}
+
+// Cancel replaces the pending user operation with a no-op execute at the same nonce and higher fees, user operations
+// paying gas in a token keep their approve call.
+// When waiting for the receipt, the result tells whether the original or the cancellation was included.
+func (c *Client) Cancel(hash []byte, waitForReceipt bool) (*CancellationResult, error) {
+	return c.CancelContext(context.Background(), hash, waitForReceipt)
+}
+
+func (c *Client) CancelContext(ctx context.Context, hash []byte, waitForReceipt bool) (*CancellationResult, error) {
+	return c.CancelWithOptionsContext(ctx, hash, waitForReceipt, nil)
+}
+
+// CancelWithOptions is Cancel with the gas price and sponsorship options of the cancellation
+func (c *Client) CancelWithOptions(hash []byte, waitForReceipt bool, options *UserOperationOptions) (*CancellationResult, error) {
+	return c.CancelWithOptionsContext(context.Background(), hash, waitForReceipt, options)
+}
+
+func (c *Client) CancelWithOptionsContext(ctx context.Context, hash []byte, waitForReceipt bool, options *UserOperationOptions) (*CancellationResult, error) {
+	return c.cancel(ctx, hash, func(pending *UserOperation) ([]byte, error) {
+		sender := pending.Sender
+		noop, err := EncodeExecuteCall(&ethereum.CallMsg{To: &sender, Value: big.NewInt(0)})
+		if err != nil {
+			return nil, err
+		}
+		return *noop, nil
+	}, waitForReceipt, options)
+}
+
+// InvalidateNonces sends a user operation calling Kernel's invalidateNonce, revoking the validators and permissions enabled
+// with validation nonces below nonce, e.g. after a session key was compromised.
+func (c *Client) InvalidateNonces(nonce uint32, waitForReceipt bool) (*CancellationResult, error) {
+	return c.InvalidateNoncesContext(context.Background(), nonce, waitForReceipt)
+}
+
+func (c *Client) InvalidateNoncesContext(ctx context.Context, nonce uint32, waitForReceipt bool) (*CancellationResult, error) {
+	return c.InvalidateNoncesWithOptionsContext(ctx, nonce, nil, waitForReceipt, nil)
+}
+
+// InvalidateNoncesWithOptions is InvalidateNonces with the gas price and sponsorship options of the invalidation.
+// With pendingHash, the pending user operation of the same sender is replaced by the nonce invalidation,
+// the result tells whether the original or the invalidation was included.
+func (c *Client) InvalidateNoncesWithOptions(nonce uint32, pendingHash []byte, waitForReceipt bool, options *UserOperationOptions) (*CancellationResult, error) {
+	return c.InvalidateNoncesWithOptionsContext(context.Background(), nonce, pendingHash, waitForReceipt, options)
+}
+
+func (c *Client) InvalidateNoncesWithOptionsContext(ctx context.Context, nonce uint32, pendingHash []byte, waitForReceipt bool, options *UserOperationOptions) (*CancellationResult, error) {
+	invalidation, err := EncodeInvalidateNonceCall(c.Signer.GetAddress(), nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	callData, err := EncodeExecuteCall(invalidation)
+	if err != nil {
+		return nil, err
+	}
+
+	if pendingHash != nil {
+		return c.cancel(ctx, pendingHash, func(*UserOperation) ([]byte, error) {
+			return *callData, nil
+		}, waitForReceipt, options)
+	}
+
+	result, err := c.SendUserOperationWithOptionsContext(ctx, callData, waitForReceipt, options)
+	if result == nil {
+		return nil, err
+	}
+
+	cancellation := &CancellationResult{
+		Cancellation: result,
+		Outcome:      CancellationOutcomePending,
+		Receipt:      result.Receipt,
+	}
+	if result.Status == UserOperationStatusIncluded {
+		cancellation.Outcome = CancellationOutcomeInvalidated
+	}
+
+	return cancellation, err
+}
+
+// cancel replaces the pending user operation with the call data built for it and optionally waits for either of them
+// to be included
+func (c *Client) cancel(ctx context.Context, hash []byte, encodeCallData func(pending *UserOperation) ([]byte, error), waitForReceipt bool, options *UserOperationOptions) (*CancellationResult, error) {
+	result := &CancellationResult{
+		OriginalHash: hash,
+		Outcome:      CancellationOutcomePending,
+	}
+
+	pending, err := c.getPendingUserOperation(ctx, hash)
+	switch {
+	case errors.Is(err, ErrUserOperationNotPending):
+		// too late, report the receipt of the original user operation
+		receipt, err := c.BundlerClient.GetUserOperationReceiptContext(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		result.Outcome = CancellationOutcomeOriginalIncluded
+		result.Receipt = receipt
+		return result, nil
+	case err != nil:
+		return nil, err
+	}
+
+	callData, err := encodeCallData(pending)
+	if err != nil {
+		return nil, err
+	}
+
+	callData, err = keepGasTokenApproval(pending, callData)
+	if err != nil {
+		return nil, err
+	}
+
+	cancellation, err := c.replaceUserOperation(ctx, hash, pending, callData, options)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Cancellation = cancellation
+	if !waitForReceipt {
+		return result, nil
+	}
+
+	receipt, index, err := c.ReceiptWaiter.WaitAnyContext(ctx, cancellation.UserOperationHash, hash)
+	if receipt == nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			cancellation.Status = UserOperationStatusTimedOut
+			err = ErrUserOperationTimedOut
+		}
+		return result, &UserOperationError{
+			UserOperationHash: cancellation.UserOperationHash,
+			Status:            cancellation.Status,
+			Err:               err,
+		}
+	}
+
+	result.Receipt = receipt
+	result.Outcome = CancellationOutcomeCancelled
+	if index == 1 {
+		result.Outcome = CancellationOutcomeOriginalIncluded
+	} else {
+		cancellation.Receipt = receipt
+		cancellation.Status = UserOperationStatusIncluded
+	}
+
+	return result, err
+}
+
+// keepGasTokenApproval prepends the approve call of the pending user operation to its replacement call data when
+// the pending one pays gas in a token it approves, the token paymaster could not charge the replacement otherwise
+func keepGasTokenApproval(pending *UserOperation, callData []byte) ([]byte, error) {
+	paymasterData, err := DecodePaymasterData(pending.PaymasterData)
+	if err != nil || paymasterData.Token == nil {
+		return callData, nil
+	}
+
+	pendingCalls, err := DecodeExecuteCall(pending.CallData)
+	if err != nil || len(pendingCalls) == 0 || !isERC20ApproveCall(&pendingCalls[0], *paymasterData.Token) {
+		return callData, nil
+	}
+
+	calls, err := DecodeExecuteCall(callData)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to prepend approve call")
+	}
+
+	batchCallData, err := EncodeExecuteBatchCall(append([]ethereum.CallMsg{pendingCalls[0]}, calls...))
+	if err != nil {
+		return nil, err
+	}
+
+	return *batchCallData, nil
+}
+
+// bumpFees raises both fees of the user operation by the bump percent of the speed up policy, or to the current gas price when higher
+func (c *Client) bumpFees(ctx context.Context, op *UserOperation, options *UserOperationOptions) error {
+	bumpPercent := uint64(defaultSpeedUpBumpPercent)
+	if policy := c.speedUpPolicy(options); policy != nil && policy.BumpPercent != 0 {
+		bumpPercent = policy.BumpPercent
+	}
+
+	gasPrice, err := c.getGasPrice(ctx, options)
+	if err != nil {
+		return err
+	}
+
+	op.MaxFeePerGas = bumpFee(op.MaxFeePerGas, bumpPercent, gasPrice.MaxFeePerGas)
+	op.MaxPriorityFeePerGas = bumpFee(op.MaxPriorityFeePerGas, bumpPercent, gasPrice.MaxPriorityFeePerGas)
+	if op.MaxPriorityFeePerGas.Cmp(op.MaxFeePerGas) > 0 {
+		op.MaxFeePerGas = new(big.Int).Set(op.MaxPriorityFeePerGas)
+	}
+
+	// the ceiling applies to the bumped fee as well, the current gas price alone may be below it
+	return c.checkMaxFeePerGas(op.MaxFeePerGas, options)
+}
+
+// bumpFee returns the fee raised by percent rounded up, or current when higher
+func bumpFee(fee *big.Int, percent uint64, current *big.Int) *big.Int {
+	bumped := big.NewInt(0)
+	if fee != nil {
+		bumped.Mul(fee, new(big.Int).SetUint64(100+percent))
+		bumped.Add(bumped, big.NewInt(99))
+		bumped.Div(bumped, big.NewInt(100))
+	}
+
+	if current != nil && current.Cmp(bumped) > 0 {
+		return new(big.Int).Set(current)
+	}
+	return bumped
+}
+
+// speedUpPolicy returns the speed up policy of the options, the Client's one by default
+func (c *Client) speedUpPolicy(options *UserOperationOptions) *SpeedUpPolicy {
+	if options.SpeedUp != nil {
+		return options.SpeedUp
+	}
+	return c.SpeedUpPolicy
+}
+
+// waitForUserOperationWithSpeedUp waits for the receipt, replacing the user operation with higher fees
+// whenever it is pending for longer than the speed up policy allows
+func (c *Client) waitForUserOperationWithSpeedUp(ctx context.Context, result *UserOperationResult, options *UserOperationOptions) error {
+	policy := c.speedUpPolicy(options)
+
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultSpeedUpMaxAttempts
+	}
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		waitCtx, cancel := context.WithTimeout(ctx, policy.After)
+		err := c.waitForUserOperation(waitCtx, result)
+		cancel()
+
+		if !errors.Is(err, ErrUserOperationTimedOut) || ctx.Err() != nil {
+			return err
+		}
+
+		// the user operation may have been bundled meanwhile, keep waiting for it when it cannot be replaced
+		replacement, err := c.SpeedUpWithOptionsContext(ctx, result.UserOperationHash, options)
+		if errors.Is(err, ErrUserOperationNotPending) {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to speed up user operation %s", hexutil.Encode(result.UserOperationHash))
+		}
+
+		result.Status = UserOperationStatusSubmitted
+		result.ReplacedHashes = append(result.ReplacedHashes, result.UserOperationHash)
+		result.UserOperationHash = replacement.UserOperationHash
+	}
+
+	return c.waitForUserOperation(ctx, result)
+}
+
+// waitForUserOperation waits for the receipt and sets the status of the result accordingly.
+// The replaced user operations may still be included instead of their replacement, the first included one becomes
+// the UserOperationHash of the result and the others its ReplacedHashes.
+func (c *Client) waitForUserOperation(ctx context.Context, result *UserOperationResult) error {
+	hashes := append(append(make([][]byte, 0, len(result.ReplacedHashes)+1), result.ReplacedHashes...), result.UserOperationHash)
+
+	receipt, index, err := c.ReceiptWaiter.WaitAnyContext(ctx, hashes...)
+	if receipt != nil {
+		if index < len(result.ReplacedHashes) {
+			result.UserOperationHash = hashes[index]
+			result.ReplacedHashes = append(hashes[:index:index], hashes[index+1:]...)
+		}
+		result.Receipt = receipt
+		result.Status = UserOperationStatusIncluded
+
+		if !receipt.Success {
+			result.Status = UserOperationStatusReverted
+			return &UserOperationError{
+				UserOperationHash: result.UserOperationHash,
+				Status:            result.Status,
+				Err:               ErrUserOperationReverted,
+			}
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	if result.Receipt == nil && errors.Is(err, context.DeadlineExceeded) {
+		result.Status = UserOperationStatusTimedOut
+		err = ErrUserOperationTimedOut
+
+		// the deadline has passed, bound the dropped check by its own timeout
+		checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), droppedCheckTimeout)
+		defer cancel()
+
+		pending, lookupErr := c.BundlerClient.GetUserOperationByHashContext(checkCtx, result.UserOperationHash)
+		if lookupErr == nil && pending == nil {
+			result.Status = UserOperationStatusDropped
+			err = ErrUserOperationDropped
+		}
+	}
+
+	return &UserOperationError{
+		UserOperationHash: result.UserOperationHash,
+		Status:            result.Status,
+		Err:               err,
+	}
+}
+
 // SendUserOperation creates and sends a signed user operation using the provided call data.
 // Sender of the user operation is the client's Sender and the signer is SenderSigner
 func (c *Client) SendUserOperation(callData *[]byte, waitForReceipt bool) (*UserOperationResult, error) {
-	op, opHash, err := c.GetUserOperationAndHashToSign(c.Signer.GetAddress(), callData)
+	return c.SendUserOperationContext(context.Background(), callData, waitForReceipt)
+}
+
+// SendUserOperationContext is SendUserOperation using the provided context for all RPC calls.
+func (c *Client) SendUserOperationContext(ctx context.Context, callData *[]byte, waitForReceipt bool) (*UserOperationResult, error) {
+	return c.SendUserOperationWithOptionsContext(ctx, callData, waitForReceipt, nil)
+}
+
+// SendUserOperationWithOptions is SendUserOperation with options changing how the user operation is paid for
+func (c *Client) SendUserOperationWithOptions(callData *[]byte, waitForReceipt bool, options *UserOperationOptions) (*UserOperationResult, error) {
+	return c.SendUserOperationWithOptionsContext(context.Background(), callData, waitForReceipt, options)
+}
+
+func (c *Client) SendUserOperationWithOptionsContext(ctx context.Context, callData *[]byte, waitForReceipt bool, options *UserOperationOptions) (*UserOperationResult, error) {
+	prepared, err := c.prepareUserOperation(ctx, c.Signer.GetAddress(), callData, options)
 	if err != nil {
 		return nil, err
 	}
 
-	signature, err := c.Signer.SignUserOperationHash(*opHash)
+	signature, err := c.Signer.SignUserOperationHash(*prepared.Hash)
 	if err != nil {
+		c.releaseNonce(prepared.Op.Sender, prepared.Op.Nonce)
 		return nil, err
 	}
 
-	op.Signature = signature
+	prepared.Op.Signature = signature
+
+	result, err := c.SendSignedUserOperationWithOptionsContext(ctx, prepared.Op, waitForReceipt, options)
+	if result != nil {
+		result.PaymentMode = prepared.PaymentMode
+		c.recordGasUsage(prepared, result.Receipt)
+	}
+
+	return result, err
+}
+
+// recordGasUsage lets the GasTuner learn from the receipt of a user operation with an estimated call gas limit
+func (c *Client) recordGasUsage(prepared *preparedUserOperation, receipt *GetUserOperationReceiptResponse) {
+	if c.GasTuner == nil || receipt == nil {
+		return
+	}
+
+	var appliedPercent uint64
+	if prepared.GasLimits != nil {
+		if prepared.GasLimits.CallGasLimit != nil {
+			return
+		}
+		appliedPercent = prepared.GasLimits.CallGasMultiplierPercent
+	}
+
+	c.GasTuner.Record(prepared.Op, appliedPercent, receipt)
+}
 
-	return c.SendSignedUserOperation(op, waitForReceipt)
+func (c *Client) GetUserOperationReceipt(result *UserOperationResult) (*GetUserOperationReceiptResponse, error) {
+	return c.GetUserOperationReceiptContext(context.Background(), result)
 }
 
-func (c *Client) GetUserOperationReceipt(result *UserOperationResult) (*UserOperationReceipt, error) {
-	return c.BundlerClient.GetUserOperationReceipt(result.UserOperationHash, c.ReceiptPollingDelay, c.ReceiptPollingRetries)
+func (c *Client) GetUserOperationReceiptContext(ctx context.Context, result *UserOperationResult) (*GetUserOperationReceiptResponse, error) {
+	return c.ReceiptWaiter.WaitContext(ctx, result.UserOperationHash)
 }
 
 func (c *Client) GetSmartAccountSigner(address common.Address, pk *ecdsa.PrivateKey) (types.AccountSigner, error) {
@@ -0,0 +1,1339 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/go-zerodev/account"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/friendsofgo/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates a client using the same mock for the network, bundler and paymaster RPC
+func newTestClient(t *testing.T, rpcClient *mockRPCClient) *Client {
+	bundlerClient := newTestBundlerClient(t, rpcClient)
+
+	receiptWaiter, err := NewReceiptWaiter(bundlerClient, rpcClient, ReceiptWaiterConfig{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+		Timeout:         20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	paymasterClient, err := NewPaymasterClient(rpcClient, bundlerClient.EntryPoint, bundlerClient.ChainID)
+	require.NoError(t, err)
+
+	return &Client{
+		EntryPoint:      bundlerClient.EntryPoint,
+		PaymasterClient: paymasterClient,
+		BundlerClient:   bundlerClient,
+		ChainID:         bundlerClient.ChainID,
+		Network:         rpcClient,
+		ReceiptWaiter:   receiptWaiter,
+	}
+}
+
+func TestClient_SendSignedUserOperationContext(t *testing.T) {
+	rpcFailure := errors.New("connection refused")
+
+	tests := []struct {
+		name           string
+		responses      map[string]string
+		receiptError   error
+		expectedStatus UserOperationStatus
+		expectedError  error
+	}{
+		{
+			name: "included",
+			responses: map[string]string{
+				"eth_getUserOperationReceipt": `{"userOpHash":"0x01","success":true,"logs":[],"receipt":{}}`,
+			},
+			expectedStatus: UserOperationStatusIncluded,
+		},
+		{
+			name: "reverted",
+			responses: map[string]string{
+				"eth_getUserOperationReceipt": `{"userOpHash":"0x01","success":false,"logs":[],"receipt":{}}`,
+			},
+			expectedStatus: UserOperationStatusReverted,
+			expectedError:  ErrUserOperationReverted,
+		},
+		{
+			name: "timed_out",
+			responses: map[string]string{
+				"eth_getUserOperationReceipt": `null`,
+				"eth_getUserOperationByHash":  `{"userOperation":null,"entryPoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032"}`,
+			},
+			expectedStatus: UserOperationStatusTimedOut,
+			expectedError:  ErrUserOperationTimedOut,
+		},
+		{
+			name: "dropped",
+			responses: map[string]string{
+				"eth_getUserOperationReceipt": `null`,
+				"eth_getUserOperationByHash":  `null`,
+			},
+			expectedStatus: UserOperationStatusDropped,
+			expectedError:  ErrUserOperationDropped,
+		},
+		{
+			name:           "rpc_failure",
+			responses:      map[string]string{},
+			receiptError:   rpcFailure,
+			expectedStatus: UserOperationStatusSubmitted,
+			expectedError:  rpcFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := jsonResponses(tt.responses)
+			client := newTestClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					switch method {
+					case "eth_sendUserOperation":
+						return json.Unmarshal([]byte(`"0x01"`), result)
+					case "eth_getUserOperationReceipt":
+						if tt.receiptError != nil {
+							return tt.receiptError
+						}
+					}
+					return responses.CallContext(ctx, result, method, args...)
+				},
+			})
+
+			op := &UserOperation{Sender: common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"), Nonce: big.NewInt(1)}
+			result, err := client.SendSignedUserOperationContext(context.Background(), op, true)
+
+			require.NotNil(t, result)
+			assert.Equal(t, tt.expectedStatus, result.Status)
+
+			if tt.expectedError == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.expectedError)
+
+			var opErr *UserOperationError
+			require.ErrorAs(t, err, &opErr)
+			assert.Equal(t, tt.expectedStatus, opErr.Status)
+		})
+	}
+}
+
+func TestClient_GetUserOperationAndHashToSignWithOptions_GasToken(t *testing.T) {
+	token := common.HexToAddress("0xE261D618a959aFfFd53168Cd07D12E37B26761db")
+	target := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	// the sponsoring paymaster differs from the default token paymaster named by quotes without paymaster
+	paymaster := common.HexToAddress("0x7777777777777849c56f2850848cE1C4da65c68b")
+	sponsorResponse := `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"` + paymaster.Hex() + `","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10","maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}`
+
+	tests := []struct {
+		name             string
+		allowance        string
+		expectedCalls    int
+		expectedApproval *big.Int
+		// approvedCost is the quoted cost of the user operation with the approve call, 0x64 when empty
+		approvedCost string
+		expectedErr  error
+	}{
+		{
+			name:          "sufficient_allowance",
+			allowance:     "0x00000000000000000000000000000000000000000000000000000000000003e8",
+			expectedCalls: 1,
+		},
+		{
+			name:             "approve_prepended",
+			allowance:        "0x0000000000000000000000000000000000000000000000000000000000000000",
+			expectedCalls:    2,
+			expectedApproval: big.NewInt(120),
+		},
+		{
+			name:         "approval_exceeded",
+			allowance:    "0x0000000000000000000000000000000000000000000000000000000000000000",
+			approvedCost: "0xc8",
+			expectedErr:  ErrInsufficientGasTokenApproval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sponsorRequests []SponsorUserOperationRequest
+			client := newTestClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					var response string
+					switch method {
+					case "eth_call":
+						// the nonce is read from the entrypoint without a block tag, the allowance from the token at latest
+						response = `"0x0000000000000000000000000000000000000000000000000000000000000001"`
+						if len(args) == 2 {
+							response = `"` + tt.allowance + `"`
+						}
+					case "zd_getUserOperationGasPrice":
+						response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+					case "zd_sponsorUserOperation":
+						request := args[0].(SponsorUserOperationRequest)
+						request.Operation = &UserOperation{CallData: request.Operation.CallData}
+						sponsorRequests = append(sponsorRequests, request)
+						response = sponsorResponse
+					case "stackup_getERC20TokenQuotes":
+						cost := "0x64"
+						if len(sponsorRequests) > 1 && tt.approvedCost != "" {
+							cost = tt.approvedCost
+						}
+						response = `{"maxGasCostToken":"` + cost + `","tokenDecimals":"0x12"}`
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			})
+
+			value := big.NewInt(1e18)
+			callData, err := EncodeExecuteCall(&ethereum.CallMsg{To: &target, Value: value, Data: common.FromHex("0x1234")})
+			require.NoError(t, err)
+
+			op, _, err := client.GetUserOperationAndHashToSignWithOptions(target, callData, &UserOperationOptions{GasToken: &token})
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			require.NotEmpty(t, sponsorRequests)
+			for _, request := range sponsorRequests {
+				require.NotNil(t, request.GasTokenData)
+				assert.Equal(t, token, request.GasTokenData.TokenAddress)
+			}
+
+			calls, err := DecodeExecuteCall(op.CallData)
+			require.NoError(t, err)
+			require.Len(t, calls, tt.expectedCalls)
+			assert.Equal(t, common.FromHex("0x1234"), calls[len(calls)-1].Data)
+			assert.Equal(t, value, calls[len(calls)-1].Value)
+
+			if tt.expectedApproval != nil {
+				expectedApprove, err := EncodeERC20ApproveCall(token, paymaster, tt.expectedApproval)
+				require.NoError(t, err)
+				assert.Equal(t, token, *calls[0].To)
+				assert.Equal(t, expectedApprove.Data, calls[0].Data)
+			}
+		})
+	}
+}
+
+func TestClient_GetUserOperationAndHashToSignWithOptions_Sponsorship(t *testing.T) {
+	target := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	shouldConsume := false
+
+	tests := []struct {
+		name            string
+		sponsorship     *SponsorshipOptions
+		expectedRequest SponsorUserOperationRequest
+	}{
+		{
+			name:            "defaults",
+			expectedRequest: SponsorUserOperationRequest{ShouldConsume: true},
+		},
+		{
+			name: "policy_and_webhook_data",
+			sponsorship: &SponsorshipOptions{
+				PolicyID:          "sp_feature",
+				WebhookData:       map[string]interface{}{"feature": "vehicle"},
+				ShouldOverrideFee: true,
+				ShouldConsume:     &shouldConsume,
+			},
+			expectedRequest: SponsorUserOperationRequest{
+				ShouldOverrideFee:   true,
+				ShouldConsume:       false,
+				SponsorshipPolicyID: "sp_feature",
+				WebhookData:         map[string]interface{}{"feature": "vehicle"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sponsorRequest SponsorUserOperationRequest
+			client := newTestClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					var response string
+					switch method {
+					case "eth_call":
+						response = `"0x0000000000000000000000000000000000000000000000000000000000000001"`
+					case "zd_getUserOperationGasPrice":
+						response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+					case "zd_sponsorUserOperation":
+						sponsorRequest = args[0].(SponsorUserOperationRequest)
+						response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10","maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}`
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			})
+
+			callData := common.FromHex("0x1234")
+			_, _, err := client.GetUserOperationAndHashToSignWithOptions(target, &callData, &UserOperationOptions{Sponsorship: tt.sponsorship})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedRequest.ShouldOverrideFee, sponsorRequest.ShouldOverrideFee)
+			assert.Equal(t, tt.expectedRequest.ShouldConsume, sponsorRequest.ShouldConsume)
+			assert.Equal(t, tt.expectedRequest.SponsorshipPolicyID, sponsorRequest.SponsorshipPolicyID)
+			assert.Equal(t, tt.expectedRequest.WebhookData, sponsorRequest.WebhookData)
+		})
+	}
+}
+
+func TestClient_GetUserOperationAndHashToSign_SelfFunded(t *testing.T) {
+	tests := []struct {
+		name          string
+		deposit       string
+		balance       string
+		expectedError error
+	}{
+		{
+			name:    "covered_by_deposit_and_balance",
+			deposit: "0x0000000000000000000000000000000000000000000000000000000000040000",
+			balance: `"0x10000"`,
+		},
+		{
+			name:          "insufficient_prefund",
+			deposit:       "0x0000000000000000000000000000000000000000000000000000000000000000",
+			balance:       `"0x10000"`,
+			expectedError: ErrInsufficientPrefund,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods []string
+			client := newTestClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					methods = append(methods, method)
+
+					var response string
+					switch method {
+					case "eth_call":
+						response = `"` + tt.deposit + `"`
+					case "eth_getBalance":
+						response = tt.balance
+					case "zd_getUserOperationGasPrice":
+						response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x2","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+					case "eth_estimateUserOperationGas":
+						response = `{"preVerificationGas":"0xd3e3","verificationGasLimit":"0x1079b","callGasLimit":"0x3f7e","paymasterVerificationGasLimit":"0x0","paymasterPostOpGasLimit":"0x0"}`
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			})
+			client.PaymasterClient = nil
+
+			sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+			callData := common.FromHex("0x1234")
+			op, opHash, err := client.GetUserOperationAndHashToSign(sender, &callData)
+
+			assert.NotContains(t, methods, "zd_sponsorUserOperation")
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, opHash)
+			assert.Empty(t, op.Paymaster)
+			assert.Equal(t, big.NewInt(0x3f7e), op.CallGasLimit)
+			// (0xd3e3 + 0x1079b + 0x3f7e) * 2 wei
+			assert.Equal(t, big.NewInt(0x435f8), op.RequiredPrefund())
+		})
+	}
+}
+
+func TestClient_SendUserOperationWithOptionsContext_Fallback(t *testing.T) {
+	rejected := &jsonRPCError{code: RPCCodeRejectedByPaymaster, message: "sponsorship policy exhausted"}
+
+	tests := []struct {
+		name          string
+		sponsorErr    error
+		balance       string
+		fallbackModes []PaymentMode
+		expectedMode  PaymentMode
+		expectedError []error
+	}{
+		{
+			name:          "no_fallback",
+			sponsorErr:    rejected,
+			expectedError: []error{ErrRejectedByPaymaster},
+		},
+		{
+			name:          "fallback_to_self_funded",
+			sponsorErr:    rejected,
+			fallbackModes: []PaymentMode{PaymentModeSelfFunded},
+			expectedMode:  PaymentModeSelfFunded,
+		},
+		{
+			name:          "fallback_when_throttled",
+			sponsorErr:    &jsonRPCError{code: RPCCodeThrottledOrBanned, message: "too many requests"},
+			fallbackModes: []PaymentMode{PaymentModeSelfFunded},
+			expectedMode:  PaymentModeSelfFunded,
+		},
+		{
+			name:          "fallback_on_http_429",
+			sponsorErr:    rpc.HTTPError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"},
+			fallbackModes: []PaymentMode{PaymentModeSelfFunded},
+			expectedMode:  PaymentModeSelfFunded,
+		},
+		{
+			name:          "fallback_on_http_5xx",
+			sponsorErr:    rpc.HTTPError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"},
+			fallbackModes: []PaymentMode{PaymentModeSelfFunded},
+			expectedMode:  PaymentModeSelfFunded,
+		},
+		{
+			name:          "fallback_on_transport_error",
+			sponsorErr:    errors.New("dial tcp: connection refused"),
+			fallbackModes: []PaymentMode{PaymentModeSelfFunded},
+			expectedMode:  PaymentModeSelfFunded,
+		},
+		{
+			name:          "no_fallback_on_validation_error",
+			sponsorErr:    &jsonRPCError{code: RPCCodeRejectedByEntryPoint, message: "AA25 invalid account nonce"},
+			fallbackModes: []PaymentMode{PaymentModeSelfFunded},
+			expectedError: []error{ErrAA25InvalidNonce},
+		},
+		{
+			name:          "all_payment_modes_failed",
+			sponsorErr:    rejected,
+			balance:       "0x0",
+			fallbackModes: []PaymentMode{PaymentModeSelfFunded},
+			expectedError: []error{ErrRejectedByPaymaster, ErrInsufficientPrefund},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods []string
+			rpcClient := &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					var response string
+					methods = append(methods, method)
+					switch method {
+					case "zd_sponsorUserOperation":
+						return tt.sponsorErr
+					case "eth_call":
+						response = `"0x0000000000000000000000000000000000000000000000000000000000000000"`
+					case "eth_getBalance":
+						response = `"0xde0b6b3a7640000"`
+						if tt.balance != "" {
+							response = `"` + tt.balance + `"`
+						}
+					case "zd_getUserOperationGasPrice":
+						response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+					case "eth_estimateUserOperationGas":
+						response = `{"preVerificationGas":"0xd3e3","verificationGasLimit":"0x1079b","callGasLimit":"0x3f7e"}`
+					case "eth_sendUserOperation":
+						response = `"0x01"`
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			}
+
+			privateKey, err := crypto.GenerateKey()
+			require.NoError(t, err)
+
+			client := newTestClient(t, rpcClient)
+			client.Signer, err = account.NewSmartAccountPrivateKeySigner(rpcClient, common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"), privateKey)
+			require.NoError(t, err)
+
+			callData := common.FromHex("0x1234")
+			result, err := client.SendUserOperationWithOptionsContext(context.Background(), &callData, false, &UserOperationOptions{
+				FallbackPaymentModes: tt.fallbackModes,
+			})
+
+			if tt.expectedError != nil {
+				for _, expectedError := range tt.expectedError {
+					assert.ErrorIs(t, err, expectedError)
+				}
+				if len(tt.fallbackModes) > 0 && len(tt.expectedError) == 1 {
+					assert.NotContains(t, methods, "eth_estimateUserOperationGas")
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedMode, result.PaymentMode)
+		})
+	}
+}
+
+func TestClient_SendSignedUserOperationWithOptionsContext_ExpiredSponsorship(t *testing.T) {
+	expired, err := EncodeVerifyingPaymasterData(uint64(time.Now().Add(-time.Minute).Unix()), 0, make([]byte, 65))
+	require.NoError(t, err)
+
+	renewed, err := EncodeVerifyingPaymasterData(uint64(time.Now().Add(time.Hour).Unix()), 0, make([]byte, 65))
+	require.NoError(t, err)
+
+	errSignerUnavailable := errors.New("signer unavailable")
+
+	tests := []struct {
+		name          string
+		resign        bool
+		resignError   error
+		expectedError error
+	}{
+		{
+			name:          "without_resign",
+			expectedError: ErrSponsorshipExpired,
+		},
+		{
+			name:          "resign_failed",
+			resign:        true,
+			resignError:   errSignerUnavailable,
+			expectedError: errSignerUnavailable,
+		},
+		{
+			name:   "responsored_and_resigned",
+			resign: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent *UserOperation
+			client := newTestClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					var response string
+					switch method {
+					case "zd_sponsorUserOperation":
+						response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"` + hexutil.Encode(renewed) + `","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+					case "eth_sendUserOperation":
+						sent = args[0].(*UserOperation)
+						response = `"0x01"`
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			})
+
+			options := &UserOperationOptions{}
+			if tt.resign {
+				options.Resign = func(ctx context.Context, op *UserOperation, hash common.Hash) ([]byte, error) {
+					if tt.resignError != nil {
+						return nil, tt.resignError
+					}
+					return common.FromHex("0x02"), nil
+				}
+			}
+
+			op := &UserOperation{
+				Sender:               common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"),
+				Nonce:                big.NewInt(1),
+				MaxFeePerGas:         big.NewInt(2),
+				MaxPriorityFeePerGas: big.NewInt(1),
+				Paymaster:            common.FromHex("0x00000000000000000000000000000000000000aa"),
+				PaymasterData:        expired,
+				Signature:            common.FromHex("0x01"),
+			}
+			_, err := client.SendSignedUserOperationWithOptionsContext(context.Background(), op, false, options)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Nil(t, sent)
+				assert.Equal(t, expired, op.PaymasterData)
+				assert.Equal(t, common.FromHex("0x01"), op.Signature)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, sent)
+			assert.Equal(t, renewed, sent.PaymasterData)
+			assert.Equal(t, common.FromHex("0x02"), sent.Signature)
+			assert.Equal(t, expired, op.PaymasterData)
+			assert.Equal(t, common.FromHex("0x01"), op.Signature)
+		})
+	}
+}
+
+func TestClient_SpeedUpContext(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	pendingOp := &UserOperation{
+		Sender:                        signer.GetAddress(),
+		Nonce:                         big.NewInt(7),
+		CallData:                      common.FromHex("0x1234"),
+		CallGasLimit:                  big.NewInt(0x3f7e),
+		VerificationGasLimit:          big.NewInt(0x1079b),
+		PreVerificationGas:            big.NewInt(0xd3e3),
+		MaxFeePerGas:                  big.NewInt(100),
+		MaxPriorityFeePerGas:          big.NewInt(10),
+		Paymaster:                     common.FromHex("0x00000000000000000000000000000000000000aa"),
+		PaymasterData:                 common.FromHex("0x01"),
+		PaymasterVerificationGasLimit: big.NewInt(0x1000),
+		PaymasterPostOpGasLimit:       big.NewInt(0x10),
+		Signature:                     common.FromHex("0xdead"),
+	}
+	pendingJSON, err := json.Marshal(pendingOp)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                   string
+		blockNumber            string
+		gasPrice               string
+		ceiling                *big.Int
+		expectedMaxFee         *big.Int
+		expectedMaxPriorityFee *big.Int
+		expectedError          error
+	}{
+		{
+			name:                   "bumped_by_percent",
+			gasPrice:               `{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}`,
+			expectedMaxFee:         big.NewInt(110),
+			expectedMaxPriorityFee: big.NewInt(11),
+		},
+		{
+			name:                   "raised_to_current_gas_price",
+			gasPrice:               `{"maxFeePerGas":"0x12c","maxPriorityFeePerGas":"0x1e"}`,
+			expectedMaxFee:         big.NewInt(300),
+			expectedMaxPriorityFee: big.NewInt(30),
+		},
+		{
+			name:          "ceiling_exceeded",
+			gasPrice:      `{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}`,
+			ceiling:       big.NewInt(105),
+			expectedError: ErrMaxFeePerGasExceeded,
+		},
+		{
+			name:          "already_included",
+			blockNumber:   `,"blockNumber":"0x10"`,
+			expectedError: ErrUserOperationNotPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sponsoredOp, sentOp *UserOperation
+			client := newTestClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					var response string
+					switch method {
+					case "eth_getUserOperationByHash":
+						response = `{"userOperation":` + string(pendingJSON) + `,"entryPoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032"` + tt.blockNumber + `}`
+					case "zd_getUserOperationGasPrice":
+						response = `{"slow":` + tt.gasPrice + `,"standard":` + tt.gasPrice + `,"fast":` + tt.gasPrice + `}`
+					case "zd_sponsorUserOperation":
+						op := *args[0].(SponsorUserOperationRequest).Operation
+						sponsoredOp = &op
+						response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x02","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+					case "eth_sendUserOperation":
+						op := *args[0].(*UserOperation)
+						sentOp = &op
+						response = `"0x02"`
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			})
+			client.Signer = signer
+			client.MaxFeePerGas = tt.ceiling
+
+			result, err := client.SpeedUpContext(context.Background(), common.FromHex("0x01"))
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				assert.Nil(t, sentOp)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, common.FromHex("0x02"), result.UserOperationHash)
+			assert.Equal(t, [][]byte{common.FromHex("0x01")}, result.ReplacedHashes)
+
+			require.NotNil(t, sponsoredOp)
+			assert.Empty(t, sponsoredOp.Paymaster)
+			assert.Equal(t, tt.expectedMaxFee, sponsoredOp.MaxFeePerGas)
+
+			require.NotNil(t, sentOp)
+			assert.Equal(t, big.NewInt(7), sentOp.Nonce)
+			assert.Equal(t, tt.expectedMaxFee, sentOp.MaxFeePerGas)
+			assert.Equal(t, tt.expectedMaxPriorityFee, sentOp.MaxPriorityFeePerGas)
+			assert.Equal(t, common.FromHex("0x02"), sentOp.PaymasterData)
+
+			opHash, err := client.EntryPoint.GetUserOperationHash(sentOp)
+			require.NoError(t, err)
+			expectedSignature, err := signer.SignUserOperationHash(*opHash)
+			require.NoError(t, err)
+			assert.Equal(t, expectedSignature, sentOp.Signature)
+		})
+	}
+}
+
+func TestClient_SendSignedUserOperationWithOptionsContext_SpeedUpPolicy(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	op := &UserOperation{
+		Sender:               signer.GetAddress(),
+		Nonce:                big.NewInt(7),
+		CallData:             common.FromHex("0x1234"),
+		CallGasLimit:         big.NewInt(0x3f7e),
+		VerificationGasLimit: big.NewInt(0x1079b),
+		PreVerificationGas:   big.NewInt(0xd3e3),
+		MaxFeePerGas:         big.NewInt(100),
+		MaxPriorityFeePerGas: big.NewInt(10),
+	}
+	opJSON, err := json.Marshal(op)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                   string
+		includedHash           string
+		expectedReplacedHashes [][]byte
+	}{
+		{
+			name:                   "replacement_included",
+			includedHash:           "0x02",
+			expectedReplacedHashes: [][]byte{common.FromHex("0x01")},
+		},
+		{
+			name:                   "replaced_included",
+			includedHash:           "0x01",
+			expectedReplacedHashes: [][]byte{common.FromHex("0x02")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []*UserOperation
+			client := newTestClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					var response string
+					switch method {
+					case "eth_sendUserOperation":
+						sent = append(sent, args[0].(*UserOperation))
+						response = `"` + hexutil.Encode([]byte{byte(len(sent))}) + `"`
+					case "eth_getUserOperationByHash":
+						response = `{"userOperation":` + string(opJSON) + `,"entryPoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032"}`
+					case "zd_getUserOperationGasPrice":
+						response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+					case "eth_getUserOperationReceipt":
+						// one of the user operations gets included after the replacement was sent
+						response = `null`
+						if len(sent) > 1 && args[0] == tt.includedHash {
+							response = `{"userOpHash":"` + tt.includedHash + `","success":true,"actualGasUsed":"0x1","receipt":{}}`
+						}
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			})
+			client.Signer = signer
+
+			result, err := client.SendSignedUserOperationWithOptionsContext(context.Background(), op, true, &UserOperationOptions{
+				SpeedUp: &SpeedUpPolicy{After: 5 * time.Millisecond, MaxAttempts: 1},
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, UserOperationStatusIncluded, result.Status)
+			assert.Equal(t, common.FromHex(tt.includedHash), result.UserOperationHash)
+			assert.Equal(t, tt.expectedReplacedHashes, result.ReplacedHashes)
+			require.Len(t, sent, 2)
+			assert.Equal(t, big.NewInt(110), sent[1].MaxFeePerGas)
+		})
+	}
+}
+
+func TestClient_SendSignedUserOperationWithOptionsContext_SpeedUpFailed(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	op := &UserOperation{
+		Sender:               signer.GetAddress(),
+		Nonce:                big.NewInt(7),
+		CallData:             common.FromHex("0x1234"),
+		CallGasLimit:         big.NewInt(0x3f7e),
+		VerificationGasLimit: big.NewInt(0x1079b),
+		PreVerificationGas:   big.NewInt(0xd3e3),
+		MaxFeePerGas:         big.NewInt(100),
+		MaxPriorityFeePerGas: big.NewInt(10),
+	}
+	opJSON, err := json.Marshal(op)
+	require.NoError(t, err)
+
+	errGasPrice := errors.New("gas price unavailable")
+	var sent int
+	client := newTestClient(t, &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "eth_sendUserOperation":
+				sent++
+				response = `"0x01"`
+			case "eth_getUserOperationByHash":
+				response = `{"userOperation":` + string(opJSON) + `,"entryPoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032"}`
+			case "zd_getUserOperationGasPrice":
+				return errGasPrice
+			case "eth_getUserOperationReceipt":
+				response = `null`
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	})
+	client.Signer = signer
+
+	result, err := client.SendSignedUserOperationWithOptionsContext(context.Background(), op, true, &UserOperationOptions{
+		SpeedUp: &SpeedUpPolicy{After: 5 * time.Millisecond, MaxAttempts: 1},
+	})
+	require.ErrorIs(t, err, errGasPrice)
+
+	assert.Equal(t, UserOperationStatusTimedOut, result.Status)
+	assert.Equal(t, common.FromHex("0x01"), result.UserOperationHash)
+	assert.Empty(t, result.ReplacedHashes)
+	assert.Equal(t, 1, sent)
+}
+
+func TestClient_CancelContext(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	pendingOp := &UserOperation{
+		Sender:               signer.GetAddress(),
+		Nonce:                big.NewInt(7),
+		CallData:             common.FromHex("0x1234"),
+		CallGasLimit:         big.NewInt(0x3f7e),
+		VerificationGasLimit: big.NewInt(0x1079b),
+		PreVerificationGas:   big.NewInt(0xd3e3),
+		MaxFeePerGas:         big.NewInt(100),
+		MaxPriorityFeePerGas: big.NewInt(10),
+	}
+	pendingJSON, err := json.Marshal(pendingOp)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		blockNumber     string
+		includedHash    string
+		expectedOutcome CancellationOutcome
+		expectedSent    bool
+	}{
+		{
+			name:            "cancellation_included",
+			includedHash:    "0x02",
+			expectedOutcome: CancellationOutcomeCancelled,
+			expectedSent:    true,
+		},
+		{
+			name:            "original_included_while_waiting",
+			includedHash:    "0x01",
+			expectedOutcome: CancellationOutcomeOriginalIncluded,
+			expectedSent:    true,
+		},
+		{
+			name:            "original_already_included",
+			blockNumber:     `,"blockNumber":"0x10"`,
+			includedHash:    "0x01",
+			expectedOutcome: CancellationOutcomeOriginalIncluded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lookups int
+			var sentOp *UserOperation
+			client := newTestClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					var response string
+					switch method {
+					case "eth_getUserOperationByHash":
+						lookups++
+						response = `{"userOperation":` + string(pendingJSON) + `,"entryPoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032"` + tt.blockNumber + `}`
+					case "zd_getUserOperationGasPrice":
+						response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+					case "eth_sendUserOperation":
+						op := *args[0].(*UserOperation)
+						sentOp = &op
+						response = `"0x02"`
+					case "eth_getUserOperationReceipt":
+						response = `null`
+						if args[0] == tt.includedHash {
+							response = `{"userOpHash":"` + tt.includedHash + `","success":true,"actualGasUsed":"0x1","receipt":{}}`
+						}
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			})
+			client.Signer = signer
+
+			result, err := client.CancelContext(context.Background(), common.FromHex("0x01"), true)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedOutcome, result.Outcome)
+			assert.Equal(t, common.FromHex("0x01"), result.OriginalHash)
+			assert.Equal(t, 1, lookups)
+			require.NotNil(t, result.Receipt)
+			assert.Equal(t, hexutil.Bytes(common.FromHex(tt.includedHash)), *result.Receipt.UserOpHash)
+
+			if !tt.expectedSent {
+				assert.Nil(t, sentOp)
+				assert.Nil(t, result.Cancellation)
+				return
+			}
+
+			require.NotNil(t, sentOp)
+			assert.Equal(t, big.NewInt(7), sentOp.Nonce)
+			assert.Equal(t, big.NewInt(110), sentOp.MaxFeePerGas)
+
+			calls, err := DecodeExecuteCall(sentOp.CallData)
+			require.NoError(t, err)
+			require.Len(t, calls, 1)
+			assert.Equal(t, signer.GetAddress(), *calls[0].To)
+			assert.Empty(t, calls[0].Data)
+		})
+	}
+}
+
+func TestClient_CancelContext_GasToken(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	token := common.HexToAddress("0xE261D618a959aFfFd53168Cd07D12E37B26761db")
+	paymaster := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	target := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+	approveCall, err := EncodeERC20ApproveCall(token, paymaster, big.NewInt(1000))
+	require.NoError(t, err)
+	callData, err := EncodeExecuteBatchCall([]ethereum.CallMsg{*approveCall, {To: &target, Value: big.NewInt(0), Data: common.FromHex("0x1234")}})
+	require.NoError(t, err)
+
+	paymasterData := append([]byte{0x02, 0x00}, make([]byte, 2*uint48Length)...)
+	paymasterData = append(paymasterData, token.Bytes()...)
+	paymasterData = append(paymasterData, make([]byte, erc20ModeFieldsLength-common.AddressLength+65)...)
+
+	pendingOp := &UserOperation{
+		Sender:               signer.GetAddress(),
+		Nonce:                big.NewInt(7),
+		CallData:             *callData,
+		CallGasLimit:         big.NewInt(0x3f7e),
+		VerificationGasLimit: big.NewInt(0x1079b),
+		PreVerificationGas:   big.NewInt(0xd3e3),
+		MaxFeePerGas:         big.NewInt(100),
+		MaxPriorityFeePerGas: big.NewInt(10),
+		Paymaster:            paymaster.Bytes(),
+		PaymasterData:        paymasterData,
+	}
+	pendingJSON, err := json.Marshal(pendingOp)
+	require.NoError(t, err)
+
+	var sponsorRequest *SponsorUserOperationRequest
+	var sentOp *UserOperation
+	client := newTestClient(t, &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "eth_getUserOperationByHash":
+				response = `{"userOperation":` + string(pendingJSON) + `,"entryPoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032"}`
+			case "zd_getUserOperationGasPrice":
+				response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+			case "zd_sponsorUserOperation":
+				request := args[0].(SponsorUserOperationRequest)
+				sponsorRequest = &request
+				response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x02","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+			case "eth_sendUserOperation":
+				sentOp = args[0].(*UserOperation)
+				response = `"0x02"`
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	})
+	client.Signer = signer
+
+	result, err := client.CancelContext(context.Background(), common.FromHex("0x01"), false)
+	require.NoError(t, err)
+	assert.Equal(t, CancellationOutcomePending, result.Outcome)
+
+	require.NotNil(t, sponsorRequest)
+	require.NotNil(t, sponsorRequest.GasTokenData)
+	assert.Equal(t, token, sponsorRequest.GasTokenData.TokenAddress)
+
+	require.NotNil(t, sentOp)
+	calls, err := DecodeExecuteCall(sentOp.CallData)
+	require.NoError(t, err)
+	require.Len(t, calls, 2)
+	assert.Equal(t, token, *calls[0].To)
+	assert.Equal(t, approveCall.Data, calls[0].Data)
+	assert.Equal(t, signer.GetAddress(), *calls[1].To)
+	assert.Empty(t, calls[1].Data)
+}
+
+func TestClient_InvalidateNoncesContext(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	var sentOp *UserOperation
+	client := newTestClient(t, &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "eth_call":
+				response = `"0x0000000000000000000000000000000000000000000000000000000000000001"`
+			case "zd_getUserOperationGasPrice":
+				response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+			case "zd_sponsorUserOperation":
+				response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+			case "eth_sendUserOperation":
+				sentOp = args[0].(*UserOperation)
+				response = `"0x02"`
+			case "eth_getUserOperationReceipt":
+				response = `{"userOpHash":"0x02","success":true,"actualGasUsed":"0x1","receipt":{}}`
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	})
+	client.Signer = signer
+
+	result, err := client.InvalidateNoncesContext(context.Background(), 5, true)
+	require.NoError(t, err)
+	assert.Equal(t, CancellationOutcomeInvalidated, result.Outcome)
+
+	expectedCall, err := EncodeInvalidateNonceCall(signer.GetAddress(), 5)
+	require.NoError(t, err)
+
+	require.NotNil(t, sentOp)
+	calls, err := DecodeExecuteCall(sentOp.CallData)
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	assert.Equal(t, signer.GetAddress(), *calls[0].To)
+	assert.Equal(t, expectedCall.Data, calls[0].Data)
+}
+
+func TestClient_InvalidateNoncesWithOptionsContext_PendingHash(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	pendingOp := &UserOperation{
+		Sender:               signer.GetAddress(),
+		Nonce:                big.NewInt(7),
+		CallData:             common.FromHex("0x1234"),
+		CallGasLimit:         big.NewInt(0x3f7e),
+		VerificationGasLimit: big.NewInt(0x1079b),
+		PreVerificationGas:   big.NewInt(0xd3e3),
+		MaxFeePerGas:         big.NewInt(100),
+		MaxPriorityFeePerGas: big.NewInt(10),
+		Paymaster:            common.FromHex("0x00000000000000000000000000000000000000aa"),
+		PaymasterData:        common.FromHex("0x01"),
+	}
+	pendingJSON, err := json.Marshal(pendingOp)
+	require.NoError(t, err)
+
+	var lookups int
+	var sponsorRequest *SponsorUserOperationRequest
+	var sentOp *UserOperation
+	client := newTestClient(t, &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "eth_getUserOperationByHash":
+				lookups++
+				response = `{"userOperation":` + string(pendingJSON) + `,"entryPoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032"}`
+			case "zd_getUserOperationGasPrice":
+				response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+			case "zd_sponsorUserOperation":
+				request := args[0].(SponsorUserOperationRequest)
+				sponsorRequest = &request
+				response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x02","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+			case "eth_sendUserOperation":
+				sentOp = args[0].(*UserOperation)
+				response = `"0x02"`
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	})
+	client.Signer = signer
+
+	result, err := client.InvalidateNoncesWithOptionsContext(context.Background(), 5, common.FromHex("0x01"), false, &UserOperationOptions{
+		Sponsorship: &SponsorshipOptions{PolicyID: "sp_invalidation"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, CancellationOutcomePending, result.Outcome)
+	assert.Equal(t, common.FromHex("0x01"), result.OriginalHash)
+
+	assert.Equal(t, 1, lookups)
+	require.NotNil(t, sponsorRequest)
+	assert.Equal(t, "sp_invalidation", sponsorRequest.SponsorshipPolicyID)
+
+	expectedCall, err := EncodeInvalidateNonceCall(signer.GetAddress(), 5)
+	require.NoError(t, err)
+
+	require.NotNil(t, sentOp)
+	assert.Equal(t, big.NewInt(7), sentOp.Nonce)
+	calls, err := DecodeExecuteCall(sentOp.CallData)
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	assert.Equal(t, expectedCall.Data, calls[0].Data)
+}
+
+func TestClient_SendUserOperationContext_NonceManager(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	// the EntryPoint nonce carries the nonce key of the sender in its high bits
+	key := new(big.Int).Lsh(computeKey(signer.GetAddress()), nonceSequenceBits)
+
+	onChainNonce := int64(4)
+	var sendErr error
+	var sentNonces []int64
+	client := newTestClient(t, &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "eth_call":
+				response = `"` + hexutil.Encode(common.LeftPadBytes(new(big.Int).Add(key, big.NewInt(onChainNonce)).Bytes(), 32)) + `"`
+			case "zd_getUserOperationGasPrice":
+				response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+			case "zd_sponsorUserOperation":
+				response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+			case "eth_sendUserOperation":
+				sentNonces = append(sentNonces, new(big.Int).Sub(args[0].(*UserOperation).Nonce, key).Int64())
+				if sendErr != nil {
+					return sendErr
+				}
+				response = `"0x02"`
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	})
+	client.Signer = signer
+	client.NonceManager, err = NewNonceManager(client.BundlerClient.EntryPoint)
+	require.NoError(t, err)
+
+	callData := common.FromHex("0x1234")
+	send := func() error {
+		_, err := client.SendUserOperationContext(context.Background(), &callData, false)
+		return err
+	}
+
+	// the nonces of sent user operations are not handed out again
+	require.NoError(t, send())
+	require.NoError(t, send())
+
+	// a user operation rejected by the bundler releases its nonce
+	sendErr = &jsonRPCError{code: RPCCodeRejectedByPaymaster, message: "paymaster validation failed"}
+	require.Error(t, send())
+	sendErr = nil
+	require.NoError(t, send())
+
+	// an invalid nonce reads the nonce from the EntryPoint again
+	onChainNonce = 9
+	sendErr = &jsonRPCError{code: RPCCodeRejectedByEntryPoint, message: "AA25 invalid account nonce"}
+	require.ErrorIs(t, send(), ErrAA25InvalidNonce)
+	sendErr = nil
+	require.NoError(t, send())
+
+	assert.Equal(t, []int64{4, 5, 6, 6, 7, 9}, sentNonces)
+}
+
+func TestClient_SendSignedUserOperationContext_NonceManager(t *testing.T) {
+	sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	key := new(big.Int).Lsh(computeKey(sender), nonceSequenceBits)
+
+	var sendErr error
+	var sentNonces []int64
+	chainNonce := int64(4)
+	client := newTestClient(t, &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "eth_call":
+				response = `"` + hexutil.Encode(common.LeftPadBytes(new(big.Int).Add(key, big.NewInt(chainNonce)).Bytes(), 32)) + `"`
+			case "zd_getUserOperationGasPrice":
+				response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+			case "zd_sponsorUserOperation":
+				response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+			case "eth_sendUserOperation":
+				sentNonces = append(sentNonces, new(big.Int).Sub(args[0].(*UserOperation).Nonce, key).Int64())
+				if sendErr != nil {
+					return sendErr
+				}
+				response = `"0x02"`
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	})
+	var err error
+	client.NonceManager, err = NewNonceManager(client.BundlerClient.EntryPoint)
+	require.NoError(t, err)
+
+	callData := common.FromHex("0x1234")
+	send := func() error {
+		op, _, err := client.GetUserOperationAndHashToSignContext(context.Background(), sender, &callData)
+		require.NoError(t, err)
+
+		// signed by a custom signer of the sender
+		op.Signature = common.FromHex("0x01")
+		_, err = client.SendSignedUserOperationContext(context.Background(), op, false)
+		return err
+	}
+
+	require.NoError(t, send())
+
+	// a user operation rejected by the bundler releases its nonce
+	sendErr = &jsonRPCError{code: RPCCodeRejectedByPaymaster, message: "paymaster validation failed"}
+	require.Error(t, send())
+	sendErr = nil
+	require.NoError(t, send())
+
+	// a user operation which may have reached the bundler keeps its nonce, the nonce is read from the EntryPoint again
+	sendErr = context.DeadlineExceeded
+	require.ErrorIs(t, send(), context.DeadlineExceeded)
+	sendErr = nil
+	chainNonce = 7
+	require.NoError(t, send())
+
+	assert.Equal(t, []int64{4, 5, 5, 6, 7}, sentNonces)
+}
+
+func TestClient_SendUserOperationWithOptionsContext_NonceLanes(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	var sentNonces []*big.Int
+	client := newTestClient(t, &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "eth_call":
+				// getNonce returns the first nonce of the requested key
+				var msg struct {
+					Data hexutil.Bytes `json:"data"`
+				}
+				encoded, err := json.Marshal(args[0])
+				require.NoError(t, err)
+				require.NoError(t, json.Unmarshal(encoded, &msg))
+				key := new(big.Int).SetBytes(msg.Data[36:68])
+				response = `"` + hexutil.Encode(common.LeftPadBytes(new(big.Int).Lsh(key, nonceSequenceBits).Bytes(), 32)) + `"`
+			case "zd_getUserOperationGasPrice":
+				response = `{"slow":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"standard":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"},"fast":{"maxFeePerGas":"0x1","maxPriorityFeePerGas":"0x1"}}`
+			case "zd_sponsorUserOperation":
+				response = `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+			case "eth_sendUserOperation":
+				sentNonces = append(sentNonces, args[0].(*UserOperation).Nonce)
+				response = `"0x02"`
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	})
+	client.Signer = signer
+	client.NonceManager, err = NewNonceManager(client.BundlerClient.EntryPoint)
+	require.NoError(t, err)
+	client.LaneScheduler, err = NewLaneScheduler(2)
+	require.NoError(t, err)
+
+	callData := common.FromHex("0x1234")
+	send := func(orderingKey string) {
+		_, err := client.SendUserOperationWithOptionsContext(context.Background(), &callData, false, &UserOperationOptions{OrderingKey: orderingKey})
+		require.NoError(t, err)
+	}
+
+	sender := signer.GetAddress()
+	nonceAt := func(lane uint64, sequence int64) *big.Int {
+		nonce := new(big.Int).Lsh(laneNonceKey(sender, lane), nonceSequenceBits)
+		return nonce.Add(nonce, big.NewInt(sequence))
+	}
+
+	// independent user operations alternate between the lanes
+	send("")
+	send("")
+	send("")
+	assert.Equal(t, []*big.Int{nonceAt(0, 0), nonceAt(1, 0), nonceAt(0, 1)}, sentNonces)
+
+	// user operations with the same ordering key get consecutive nonces of one lane
+	sentNonces = nil
+	send("treasury")
+	send("treasury")
+	lane := client.LaneScheduler.Lane("treasury")
+	require.Len(t, sentNonces, 2)
+	assert.Equal(t, laneNonceKey(sender, lane), nonceKey(sentNonces[0]))
+	assert.Equal(t, new(big.Int).Add(sentNonces[0], big.NewInt(1)), sentNonces[1])
+}
+
+func TestClientConfig_ReceiptWaiterConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ClientConfig
+		expected ReceiptWaiterConfig
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:   "receipt_waiter_config",
+			config: ClientConfig{ReceiptWaiterConfig: ReceiptWaiterConfig{Timeout: time.Minute}, ReceiptPollingRetries: 3},
+			expected: ReceiptWaiterConfig{
+				Timeout: time.Minute,
+			},
+		},
+		{
+			name:   "deprecated_polling",
+			config: ClientConfig{ReceiptPollingDelaySeconds: 2, ReceiptPollingRetries: 5},
+			expected: ReceiptWaiterConfig{
+				InitialInterval: 2 * time.Second,
+				MaxInterval:     2 * time.Second,
+				Multiplier:      1,
+				Timeout:         10 * time.Second,
+			},
+		},
+		{
+			name:   "deprecated_polling_default_delay",
+			config: ClientConfig{ReceiptPollingRetries: 3},
+			expected: ReceiptWaiterConfig{
+				InitialInterval: 10 * time.Second,
+				MaxInterval:     10 * time.Second,
+				Multiplier:      1,
+				Timeout:         30 * time.Second,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.config.receiptWaiterConfig())
+		})
+	}
+}
+
+func TestNewClient_FailedInitialization(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	// a self-funded configuration has no paymaster connection to close
+	_, err = NewClient(&ClientConfig{
+		AccountPK:         privateKey,
+		EntryPointVersion: EntryPointVersion07,
+		RpcURL:            &url.URL{Scheme: "http", Host: "localhost:8545"},
+		BundlerURL:        &url.URL{Scheme: "unsupported", Host: "localhost:4337"},
+		ChainID:           big.NewInt(ChainPolygonAmoy),
+	})
+	require.ErrorContains(t, err, "failed to connect to Bundler")
+}
@@ -0,0 +1,75 @@
+package zerodev
+
+import (
+	"github.com/DIMO-Network/go-zerodev/abis"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"strings"
+)
+
+type coinbaseCall struct {
+	Target common.Address
+	Value  *big.Int
+	Data   []byte
+}
+
+// EncodeCoinbaseExecuteCall encodes a single call as Coinbase Smart Wallet execute(target, value, data) call data
+func EncodeCoinbaseExecuteCall(msg *ethereum.CallMsg) (*[]byte, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(abis.CoinbaseSmartWalletAbi))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse coinbase smart wallet abi")
+	}
+
+	call := toCoinbaseCall(msg)
+
+	callData, err := parsedABI.Pack("execute", call.Target, call.Value, call.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode execute call data")
+	}
+
+	return &callData, nil
+}
+
+// EncodeCoinbaseExecuteBatchCall encodes calls as Coinbase Smart Wallet executeBatch((target, value, data)[]) call data
+func EncodeCoinbaseExecuteBatchCall(msgs []ethereum.CallMsg) (*[]byte, error) {
+	if len(msgs) == 0 {
+		return nil, errors.New("at least one call is required")
+	}
+
+	parsedABI, err := abi.JSON(strings.NewReader(abis.CoinbaseSmartWalletAbi))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse coinbase smart wallet abi")
+	}
+
+	calls := make([]coinbaseCall, len(msgs))
+	for i := range msgs {
+		calls[i] = toCoinbaseCall(&msgs[i])
+	}
+
+	callData, err := parsedABI.Pack("executeBatch", calls)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode executeBatch call data")
+	}
+
+	return &callData, nil
+}
+
+func toCoinbaseCall(msg *ethereum.CallMsg) coinbaseCall {
+	call := coinbaseCall{
+		Value: big.NewInt(0),
+		Data:  msg.Data,
+	}
+	if msg.To != nil {
+		call.Target = *msg.To
+	}
+	if msg.Value != nil {
+		call.Value = msg.Value
+	}
+	if call.Data == nil {
+		call.Data = []byte{}
+	}
+	return call
+}
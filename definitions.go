@@ -3,6 +3,8 @@ package zerodev
 // Addresses
 const (
 	AddressZero = "0x0000000000000000000000000000000000000000"
+	// AddressERC20Paymaster07 ZeroDev ERC-20 token paymaster for entrypoint 0.7
+	AddressERC20Paymaster07 = "0x6666666666667849c56f2850848cE1C4da65c68b"
 )
 
 // SignatureDummy Signature used in interaction with paymaster to calculate fees
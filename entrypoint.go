@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -15,7 +16,19 @@ import (
 
 const (
 	EntryPointVersion07 = "0.7"
-	entrypointAbi07     = `[{"inputs": [{ "name": "sender", "type": "address" }, { "name": "key", "type": "uint192" }], "name": "getNonce", "outputs": [{ "name": "nonce", "type": "uint256" }], "stateMutability": "view", "type": "function"}]`
+	entrypointAbi07     = `[
+		{"inputs": [{ "name": "account", "type": "address" }], "name": "balanceOf", "outputs": [{ "name": "", "type": "uint256" }], "stateMutability": "view", "type": "function"},
+		{"inputs": [{ "name": "account", "type": "address" }], "name": "depositTo", "outputs": [], "stateMutability": "payable", "type": "function"},
+		{"inputs": [{ "name": "withdrawAddress", "type": "address" }, { "name": "withdrawAmount", "type": "uint256" }], "name": "withdrawTo", "outputs": [], "stateMutability": "nonpayable", "type": "function"},
+		{"inputs": [{ "name": "unstakeDelaySec", "type": "uint32" }], "name": "addStake", "outputs": [], "stateMutability": "payable", "type": "function"},
+		{"inputs": [], "name": "unlockStake", "outputs": [], "stateMutability": "nonpayable", "type": "function"},
+		{"inputs": [{ "name": "withdrawAddress", "type": "address" }], "name": "withdrawStake", "outputs": [], "stateMutability": "nonpayable", "type": "function"},
+		{"inputs": [{ "name": "account", "type": "address" }], "name": "getDepositInfo", "outputs": [{ "components": [{ "name": "deposit", "type": "uint256" }, { "name": "staked", "type": "bool" }, { "name": "stake", "type": "uint112" }, { "name": "unstakeDelaySec", "type": "uint32" }, { "name": "withdrawTime", "type": "uint48" }], "name": "info", "type": "tuple" }], "stateMutability": "view", "type": "function"},
+		{"inputs": [{ "name": "sender", "type": "address" }, { "name": "key", "type": "uint192" }], "name": "getNonce", "outputs": [{ "name": "nonce", "type": "uint256" }], "stateMutability": "view", "type": "function"},
+		{"anonymous": false, "inputs": [{ "indexed": true, "name": "userOpHash", "type": "bytes32" }, { "indexed": true, "name": "sender", "type": "address" }, { "indexed": true, "name": "paymaster", "type": "address" }, { "indexed": false, "name": "nonce", "type": "uint256" }, { "indexed": false, "name": "success", "type": "bool" }, { "indexed": false, "name": "actualGasCost", "type": "uint256" }, { "indexed": false, "name": "actualGasUsed", "type": "uint256" }], "name": "UserOperationEvent", "type": "event"},
+		{"anonymous": false, "inputs": [{ "indexed": true, "name": "userOpHash", "type": "bytes32" }, { "indexed": true, "name": "sender", "type": "address" }, { "indexed": false, "name": "nonce", "type": "uint256" }, { "indexed": false, "name": "revertReason", "type": "bytes" }], "name": "UserOperationRevertReason", "type": "event"},
+		{"anonymous": false, "inputs": [{ "indexed": true, "name": "userOpHash", "type": "bytes32" }, { "indexed": true, "name": "sender", "type": "address" }, { "indexed": false, "name": "nonce", "type": "uint256" }, { "indexed": false, "name": "revertReason", "type": "bytes" }], "name": "PostOpRevertReason", "type": "event"}
+	]`
 	entryPointAddress07 = "0x0000000071727De22E5E9d8BAf0edAc6f37da032"
 )
 
@@ -27,10 +40,32 @@ const (
 type Entrypoint interface {
 	GetAddress() common.Address
 	GetNonce(account common.Address) (*big.Int, error)
+	GetNonceContext(ctx context.Context, account common.Address) (*big.Int, error)
+	GetNonceWithKey(account common.Address, key *big.Int) (*big.Int, error)
+	GetNonceWithKeyContext(ctx context.Context, account common.Address, key *big.Int) (*big.Int, error)
+	BalanceOf(account common.Address) (*big.Int, error)
+	BalanceOfContext(ctx context.Context, account common.Address) (*big.Int, error)
+	GetDepositInfo(account common.Address) (*DepositInfo, error)
+	GetDepositInfoContext(ctx context.Context, account common.Address) (*DepositInfo, error)
+	DepositTo(account common.Address, amount *big.Int) (*ethereum.CallMsg, error)
+	WithdrawTo(withdrawAddress common.Address, amount *big.Int) (*ethereum.CallMsg, error)
+	AddStake(unstakeDelaySec uint32, amount *big.Int) (*ethereum.CallMsg, error)
+	UnlockStake() (*ethereum.CallMsg, error)
+	WithdrawStake(withdrawAddress common.Address) (*ethereum.CallMsg, error)
 	GetUserOperationHash(op *UserOperation) (*common.Hash, error)
 	PackUserOperation(op *UserOperation) ([]byte, error)
 }
 
+// DepositInfo is the deposit and stake of an account or paymaster in the EntryPoint
+type DepositInfo struct {
+	Deposit         *big.Int
+	Staked          bool
+	Stake           *big.Int
+	UnstakeDelaySec uint32
+	// WithdrawTime is the unix time the unlocked stake can be withdrawn at, zero while the stake is locked
+	WithdrawTime *big.Int
+}
+
 type EntrypointClient07 struct {
 	Client  types.RPCClient
 	Address common.Address
@@ -59,7 +94,21 @@ func (e *EntrypointClient07) GetAddress() common.Address {
 
 // GetNonce retrieves the nonce of a specific account.
 func (e *EntrypointClient07) GetNonce(account common.Address) (*big.Int, error) {
-	key := computeKey(account)
+	return e.GetNonceContext(context.Background(), account)
+}
+
+// GetNonceContext retrieves the nonce of a specific account using the provided context.
+func (e *EntrypointClient07) GetNonceContext(ctx context.Context, account common.Address) (*big.Int, error) {
+	return e.GetNonceWithKeyContext(ctx, account, computeKey(account))
+}
+
+// GetNonceWithKey retrieves the nonce of a specific account for the 192 bit nonce key.
+func (e *EntrypointClient07) GetNonceWithKey(account common.Address, key *big.Int) (*big.Int, error) {
+	return e.GetNonceWithKeyContext(context.Background(), account, key)
+}
+
+// GetNonceWithKeyContext retrieves the nonce of a specific account for the 192 bit nonce key using the provided context.
+func (e *EntrypointClient07) GetNonceWithKeyContext(ctx context.Context, account common.Address, key *big.Int) (*big.Int, error) {
 	callData, err := e.Abi.Pack("getNonce", account, key)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to pack getNonce call data")
@@ -74,8 +123,8 @@ func (e *EntrypointClient07) GetNonce(account common.Address) (*big.Int, error)
 	}
 
 	var hex hexutil.Bytes
-	if err := e.Client.CallContext(context.Background(), &hex, "eth_call", msg); err != nil {
-		return nil, errors.Wrap(err, "failed to call getNonce eth_call")
+	if err := e.Client.CallContext(ctx, &hex, "eth_call", msg); err != nil {
+		return nil, newRPCError("eth_call", errors.Wrap(err, "getNonce"))
 	}
 
 	decoded, err := hexutil.Decode(hex.String())
@@ -85,6 +134,108 @@ func (e *EntrypointClient07) GetNonce(account common.Address) (*big.Int, error)
 	return big.NewInt(0).SetBytes(decoded), nil
 }
 
+// BalanceOf retrieves the deposit of a specific account, used to prefund its user operations.
+func (e *EntrypointClient07) BalanceOf(account common.Address) (*big.Int, error) {
+	return e.BalanceOfContext(context.Background(), account)
+}
+
+// BalanceOfContext retrieves the deposit of a specific account using the provided context.
+func (e *EntrypointClient07) BalanceOfContext(ctx context.Context, account common.Address) (*big.Int, error) {
+	callData, err := e.Abi.Pack("balanceOf", account)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack balanceOf call data")
+	}
+
+	msg := struct {
+		To   common.Address `json:"to"`
+		Data hexutil.Bytes  `json:"data"`
+	}{
+		To:   e.Address,
+		Data: callData,
+	}
+
+	var hex hexutil.Bytes
+	if err := e.Client.CallContext(ctx, &hex, "eth_call", msg); err != nil {
+		return nil, newRPCError("eth_call", errors.Wrap(err, "balanceOf"))
+	}
+
+	return big.NewInt(0).SetBytes(hex), nil
+}
+
+// GetDepositInfo retrieves the deposit and stake of a specific account.
+func (e *EntrypointClient07) GetDepositInfo(account common.Address) (*DepositInfo, error) {
+	return e.GetDepositInfoContext(context.Background(), account)
+}
+
+// GetDepositInfoContext retrieves the deposit and stake of a specific account using the provided context.
+func (e *EntrypointClient07) GetDepositInfoContext(ctx context.Context, account common.Address) (*DepositInfo, error) {
+	callData, err := e.Abi.Pack("getDepositInfo", account)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack getDepositInfo call data")
+	}
+
+	msg := struct {
+		To   common.Address `json:"to"`
+		Data hexutil.Bytes  `json:"data"`
+	}{
+		To:   e.Address,
+		Data: callData,
+	}
+
+	var hex hexutil.Bytes
+	if err := e.Client.CallContext(ctx, &hex, "eth_call", msg); err != nil {
+		return nil, newRPCError("eth_call", errors.Wrap(err, "getDepositInfo"))
+	}
+
+	unpacked, err := e.Abi.Unpack("getDepositInfo", hex)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unpack getDepositInfo result")
+	}
+
+	return abi.ConvertType(unpacked[0], new(DepositInfo)).(*DepositInfo), nil
+}
+
+// DepositTo creates the call adding amount to the deposit of the account, the deposit prefunds its user operations
+func (e *EntrypointClient07) DepositTo(account common.Address, amount *big.Int) (*ethereum.CallMsg, error) {
+	return e.encodeCall(amount, "depositTo", account)
+}
+
+// WithdrawTo creates the call withdrawing amount from the deposit of the caller to withdrawAddress
+func (e *EntrypointClient07) WithdrawTo(withdrawAddress common.Address, amount *big.Int) (*ethereum.CallMsg, error) {
+	return e.encodeCall(big.NewInt(0), "withdrawTo", withdrawAddress, amount)
+}
+
+// AddStake creates the call adding amount to the stake of the caller, locked for at least unstakeDelaySec after unlocking
+func (e *EntrypointClient07) AddStake(unstakeDelaySec uint32, amount *big.Int) (*ethereum.CallMsg, error) {
+	return e.encodeCall(amount, "addStake", unstakeDelaySec)
+}
+
+// UnlockStake creates the call starting the unstake delay of the stake of the caller
+func (e *EntrypointClient07) UnlockStake() (*ethereum.CallMsg, error) {
+	return e.encodeCall(big.NewInt(0), "unlockStake")
+}
+
+// WithdrawStake creates the call withdrawing the unlocked stake of the caller to withdrawAddress
+func (e *EntrypointClient07) WithdrawStake(withdrawAddress common.Address) (*ethereum.CallMsg, error) {
+	return e.encodeCall(big.NewInt(0), "withdrawStake", withdrawAddress)
+}
+
+// encodeCall creates a call to the entrypoint, which can be sent as a transaction (after setting From) or as a user operation
+// of the smart account (with EncodeExecuteCall), the caller is the transaction sender or the smart account respectively
+func (e *EntrypointClient07) encodeCall(value *big.Int, method string, args ...interface{}) (*ethereum.CallMsg, error) {
+	data, err := e.Abi.Pack(method, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to pack %s call data", method)
+	}
+
+	to := e.Address
+	return &ethereum.CallMsg{
+		To:    &to,
+		Value: value,
+		Data:  data,
+	}, nil
+}
+
 // GetUserOperationHash calculates the hash of a UserOperation.
 func (e *EntrypointClient07) GetUserOperationHash(op *UserOperation) (*common.Hash, error) {
 	packedOp, err := e.PackUserOperation(op)
@@ -137,12 +288,16 @@ func (*EntrypointClient07) PackUserOperation(op *UserOperation) ([]byte, error)
 		op.MaxFeePerGas.Bytes(),
 	)
 
-	paymasterAndData := createPaymasterDataBuffer(
-		op.Paymaster,
-		op.PaymasterVerificationGasLimit.Bytes(),
-		op.PaymasterPostOpGasLimit.Bytes(),
-		op.PaymasterData,
-	)
+	// paymasterAndData is empty for user operations paid by the sender
+	var paymasterAndData bytes.Buffer
+	if len(op.Paymaster) > 0 {
+		paymasterAndData = createPaymasterDataBuffer(
+			op.Paymaster,
+			op.PaymasterVerificationGasLimit.Bytes(),
+			op.PaymasterPostOpGasLimit.Bytes(),
+			op.PaymasterData,
+		)
+	}
 
 	hashedPaymasterAndData := crypto.Keccak256Hash(paymasterAndData.Bytes())
 
@@ -0,0 +1,103 @@
+package zerodev
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntrypointClient07_GetDepositInfo(t *testing.T) {
+	account := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	result := hexutil.Encode(common.LeftPadBytes(big.NewInt(1000).Bytes(), 32)) +
+		common.Bytes2Hex(common.LeftPadBytes([]byte{1}, 32)) +
+		common.Bytes2Hex(common.LeftPadBytes(big.NewInt(500).Bytes(), 32)) +
+		common.Bytes2Hex(common.LeftPadBytes(big.NewInt(86400).Bytes(), 32)) +
+		common.Bytes2Hex(common.LeftPadBytes(big.NewInt(1700000000).Bytes(), 32))
+
+	entrypoint, err := NewEntrypoint07(jsonResponses(map[string]string{
+		"eth_call": `"` + result + `"`,
+	}), big.NewInt(ChainPolygonAmoy))
+	require.NoError(t, err)
+
+	info, err := entrypoint.GetDepositInfoContext(context.Background(), account)
+	require.NoError(t, err)
+
+	assert.Equal(t, &DepositInfo{
+		Deposit:         big.NewInt(1000),
+		Staked:          true,
+		Stake:           big.NewInt(500),
+		UnstakeDelaySec: 86400,
+		WithdrawTime:    big.NewInt(1700000000),
+	}, info)
+}
+
+func TestEntrypointClient07_EncodeCalls(t *testing.T) {
+	entrypoint, err := NewEntrypoint07(jsonResponses(nil), big.NewInt(ChainPolygonAmoy))
+	require.NoError(t, err)
+
+	account := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	amount := big.NewInt(1e18)
+
+	tests := []struct {
+		name          string
+		encode        func() (*ethereum.CallMsg, error)
+		expectedValue *big.Int
+		expectedArgs  []interface{}
+	}{
+		{
+			name:          "depositTo",
+			encode:        func() (*ethereum.CallMsg, error) { return entrypoint.DepositTo(account, amount) },
+			expectedValue: amount,
+			expectedArgs:  []interface{}{account},
+		},
+		{
+			name:          "withdrawTo",
+			encode:        func() (*ethereum.CallMsg, error) { return entrypoint.WithdrawTo(account, amount) },
+			expectedValue: big.NewInt(0),
+			expectedArgs:  []interface{}{account, amount},
+		},
+		{
+			name:          "addStake",
+			encode:        func() (*ethereum.CallMsg, error) { return entrypoint.AddStake(86400, amount) },
+			expectedValue: amount,
+			expectedArgs:  []interface{}{uint32(86400)},
+		},
+		{
+			name:          "unlockStake",
+			encode:        entrypoint.UnlockStake,
+			expectedValue: big.NewInt(0),
+			expectedArgs:  []interface{}{},
+		},
+		{
+			name:          "withdrawStake",
+			encode:        func() (*ethereum.CallMsg, error) { return entrypoint.WithdrawStake(account) },
+			expectedValue: big.NewInt(0),
+			expectedArgs:  []interface{}{account},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := tt.encode()
+			require.NoError(t, err)
+
+			assert.Equal(t, entrypoint.GetAddress(), *msg.To)
+			assert.NotSame(t, &entrypoint.Address, msg.To)
+			assert.Equal(t, tt.expectedValue, msg.Value)
+
+			method, err := entrypoint.Abi.MethodById(msg.Data[:4])
+			require.NoError(t, err)
+			assert.Equal(t, tt.name, method.Name)
+
+			args, err := method.Inputs.Unpack(msg.Data[4:])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
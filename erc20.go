@@ -0,0 +1,74 @@
+package zerodev
+
+import (
+	"bytes"
+	"context"
+	"github.com/DIMO-Network/go-zerodev/abis"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"strings"
+)
+
+var erc20ApproveSelector = crypto.Keccak256([]byte("approve(address,uint256)"))[:4]
+
+// EncodeERC20ApproveCall creates the call approving spender to transfer amount of the token
+func EncodeERC20ApproveCall(token common.Address, spender common.Address, amount *big.Int) (*ethereum.CallMsg, error) {
+	parsedAbi, err := abi.JSON(strings.NewReader(abis.Erc20Abi))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse erc20 abi")
+	}
+
+	data, err := parsedAbi.Pack("approve", spender, amount)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack approve call data")
+	}
+
+	return &ethereum.CallMsg{
+		To:    &token,
+		Value: big.NewInt(0),
+		Data:  data,
+	}, nil
+}
+
+// isERC20ApproveCall reports whether the call approves a spender of the token
+func isERC20ApproveCall(msg *ethereum.CallMsg, token common.Address) bool {
+	return msg.To != nil && *msg.To == token && len(msg.Data) >= 4 && bytes.Equal(msg.Data[:4], erc20ApproveSelector)
+}
+
+// GetERC20Allowance returns the amount of the token spender is allowed to transfer from owner
+func GetERC20Allowance(client types.RPCClient, token common.Address, owner common.Address, spender common.Address) (*big.Int, error) {
+	return GetERC20AllowanceContext(context.Background(), client, token, owner, spender)
+}
+
+func GetERC20AllowanceContext(ctx context.Context, client types.RPCClient, token common.Address, owner common.Address, spender common.Address) (*big.Int, error) {
+	parsedAbi, err := abi.JSON(strings.NewReader(abis.Erc20Abi))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse erc20 abi")
+	}
+
+	callData, err := parsedAbi.Pack("allowance", owner, spender)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack allowance call data")
+	}
+
+	msg := struct {
+		To   common.Address `json:"to"`
+		Data hexutil.Bytes  `json:"data"`
+	}{
+		To:   token,
+		Data: callData,
+	}
+
+	var hex hexutil.Bytes
+	if err := client.CallContext(ctx, &hex, "eth_call", msg, BlockTagLatest); err != nil {
+		return nil, newRPCError("eth_call", errors.Wrap(err, "allowance"))
+	}
+
+	return big.NewInt(0).SetBytes(hex), nil
+}
@@ -0,0 +1,261 @@
+package zerodev
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/friendsofgo/errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrUserOperationTimedOut the receipt was not available before the deadline, the bundler still knows the user operation
+	ErrUserOperationTimedOut = errors.New("user operation receipt not available before deadline")
+	// ErrUserOperationDropped the receipt was not available before the deadline and the bundler no longer knows the user operation
+	ErrUserOperationDropped = errors.New("user operation dropped by bundler")
+	// ErrUserOperationReverted the user operation was included but its call reverted
+	ErrUserOperationReverted = errors.New("user operation reverted")
+	// ErrInsufficientPrefund the EntryPoint deposit and the native balance of a self-funded sender do not cover the required prefund
+	ErrInsufficientPrefund = errors.New("insufficient funds for user operation prefund")
+	// ErrSponsorshipExpired the paymaster sponsorship of a pre-signed user operation expired before sending
+	ErrSponsorshipExpired = errors.New("paymaster sponsorship expired")
+	// ErrMaxFeePerGasExceeded the gas price of the oracle is above the MaxFeePerGas ceiling
+	ErrMaxFeePerGasExceeded = errors.New("gas price above max fee per gas ceiling")
+	// ErrInsufficientGasTokenApproval the token cost of the user operation with the prepended approve call is above the approved amount
+	ErrInsufficientGasTokenApproval = errors.New("gas token cost above approved amount")
+	// ErrPaymasterNotConfigured the payment mode requires a paymaster but the client has none
+	ErrPaymasterNotConfigured = errors.New("paymaster not configured")
+	// ErrGasTokenNotSupported the paymaster does not let the sender pay for gas in ERC-20 tokens
+	ErrGasTokenNotSupported = errors.New("paymaster does not support paying gas in ERC-20 tokens")
+	// ErrSponsoredGasLimitsMismatch the paymaster signed other gas limits than the adjusted ones of the user operation
+	ErrSponsoredGasLimitsMismatch = errors.New("sponsored gas limits differ from the adjusted ones")
+	// ErrUserOperationNotPending the user operation to replace was already included
+	ErrUserOperationNotPending = errors.New("user operation is not pending")
+)
+
+// JSON-RPC error codes of ERC-4337 bundlers (ERC-7769) and ERC-7677 paymasters
+const (
+	RPCCodeRejectedByEntryPoint  = -32500
+	RPCCodeRejectedByPaymaster   = -32501
+	RPCCodeBannedOpcode          = -32502
+	RPCCodeOutOfTimeRange        = -32503
+	RPCCodeThrottledOrBanned     = -32504
+	RPCCodeInsufficientStake     = -32505
+	RPCCodeUnsupportedAggregator = -32506
+	RPCCodeInvalidSignature      = -32507
+	RPCCodeExecutionReverted     = -32521
+	RPCCodeInvalidUserOperation  = -32602
+)
+
+var (
+	ErrRejectedByEntryPoint  = errors.New("rejected by entrypoint validation")
+	ErrRejectedByPaymaster   = errors.New("rejected by paymaster validation")
+	ErrBannedOpcode          = errors.New("banned opcode or storage access in validation")
+	ErrOutOfTimeRange        = errors.New("validity time range expired or not due")
+	ErrThrottledOrBanned     = errors.New("paymaster or aggregator throttled or banned")
+	ErrInsufficientStake     = errors.New("stake or unstake delay too low")
+	ErrUnsupportedAggregator = errors.New("unsupported aggregator")
+	ErrInvalidSignature      = errors.New("invalid signature")
+	ErrExecutionReverted     = errors.New("execution reverted")
+	ErrInvalidUserOperation  = errors.New("invalid user operation")
+
+	rpcCodeErrors = map[int]error{
+		RPCCodeRejectedByEntryPoint:  ErrRejectedByEntryPoint,
+		RPCCodeRejectedByPaymaster:   ErrRejectedByPaymaster,
+		RPCCodeBannedOpcode:          ErrBannedOpcode,
+		RPCCodeOutOfTimeRange:        ErrOutOfTimeRange,
+		RPCCodeThrottledOrBanned:     ErrThrottledOrBanned,
+		RPCCodeInsufficientStake:     ErrInsufficientStake,
+		RPCCodeUnsupportedAggregator: ErrUnsupportedAggregator,
+		RPCCodeInvalidSignature:      ErrInvalidSignature,
+		RPCCodeExecutionReverted:     ErrExecutionReverted,
+		RPCCodeInvalidUserOperation:  ErrInvalidUserOperation,
+	}
+)
+
+// AAError is an ERC-4337 EntryPoint failure reason, e.g. "AA25 invalid account nonce"
+type AAError struct {
+	Code   string
+	Reason string
+}
+
+func (e *AAError) Error() string {
+	return e.Code + " " + e.Reason
+}
+
+// EntryPoint 0.7 failure reasons
+var (
+	ErrAA10SenderAlreadyConstructed     = &AAError{Code: "AA10", Reason: "sender already constructed"}
+	ErrAA13InitCodeFailed               = &AAError{Code: "AA13", Reason: "initCode failed or OOG"}
+	ErrAA14InitCodeMustReturnSender     = &AAError{Code: "AA14", Reason: "initCode must return sender"}
+	ErrAA15InitCodeMustCreateSender     = &AAError{Code: "AA15", Reason: "initCode must create sender"}
+	ErrAA20AccountNotDeployed           = &AAError{Code: "AA20", Reason: "account not deployed"}
+	ErrAA21PrefundNotPaid               = &AAError{Code: "AA21", Reason: "didn't pay prefund"}
+	ErrAA22ExpiredOrNotDue              = &AAError{Code: "AA22", Reason: "expired or not due"}
+	ErrAA23Reverted                     = &AAError{Code: "AA23", Reason: "reverted"}
+	ErrAA24SignatureError               = &AAError{Code: "AA24", Reason: "signature error"}
+	ErrAA25InvalidNonce                 = &AAError{Code: "AA25", Reason: "invalid account nonce"}
+	ErrAA26OverVerificationGasLimit     = &AAError{Code: "AA26", Reason: "over verificationGasLimit"}
+	ErrAA30PaymasterNotDeployed         = &AAError{Code: "AA30", Reason: "paymaster not deployed"}
+	ErrAA31PaymasterDepositTooLow       = &AAError{Code: "AA31", Reason: "paymaster deposit too low"}
+	ErrAA32PaymasterExpiredOrNotDue     = &AAError{Code: "AA32", Reason: "paymaster expired or not due"}
+	ErrAA33PaymasterReverted            = &AAError{Code: "AA33", Reason: "paymaster reverted"}
+	ErrAA34PaymasterSignatureError      = &AAError{Code: "AA34", Reason: "paymaster signature error"}
+	ErrAA36OverPaymasterVerificationGas = &AAError{Code: "AA36", Reason: "over paymasterVerificationGasLimit"}
+	ErrAA40OverVerificationGasLimit     = &AAError{Code: "AA40", Reason: "over verificationGasLimit"}
+	ErrAA41TooLittleVerificationGas     = &AAError{Code: "AA41", Reason: "too little verificationGas"}
+	ErrAA50PostOpReverted               = &AAError{Code: "AA50", Reason: "postOp reverted"}
+	ErrAA51PrefundBelowActualGasCost    = &AAError{Code: "AA51", Reason: "prefund below actualGasCost"}
+	ErrAA90InvalidBeneficiary           = &AAError{Code: "AA90", Reason: "invalid beneficiary"}
+	ErrAA91FailedSendToBeneficiary      = &AAError{Code: "AA91", Reason: "failed send to beneficiary"}
+	ErrAA92InternalCallOnly             = &AAError{Code: "AA92", Reason: "internal call only"}
+	ErrAA93InvalidPaymasterAndData      = &AAError{Code: "AA93", Reason: "invalid paymasterAndData"}
+	ErrAA94GasValuesOverflow            = &AAError{Code: "AA94", Reason: "gas values overflow"}
+	ErrAA95OutOfGas                     = &AAError{Code: "AA95", Reason: "out of gas"}
+	ErrAA96InvalidAggregator            = &AAError{Code: "AA96", Reason: "invalid aggregator"}
+)
+
+var (
+	aaErrors = map[string]*AAError{}
+
+	aaCodePattern = regexp.MustCompile(`\bAA[0-9]{2}\b`)
+)
+
+func init() {
+	for _, aaErr := range []*AAError{
+		ErrAA10SenderAlreadyConstructed, ErrAA13InitCodeFailed, ErrAA14InitCodeMustReturnSender, ErrAA15InitCodeMustCreateSender,
+		ErrAA20AccountNotDeployed, ErrAA21PrefundNotPaid, ErrAA22ExpiredOrNotDue, ErrAA23Reverted, ErrAA24SignatureError,
+		ErrAA25InvalidNonce, ErrAA26OverVerificationGasLimit, ErrAA30PaymasterNotDeployed, ErrAA31PaymasterDepositTooLow,
+		ErrAA32PaymasterExpiredOrNotDue, ErrAA33PaymasterReverted, ErrAA34PaymasterSignatureError, ErrAA36OverPaymasterVerificationGas,
+		ErrAA40OverVerificationGasLimit, ErrAA41TooLittleVerificationGas, ErrAA50PostOpReverted, ErrAA51PrefundBelowActualGasCost,
+		ErrAA90InvalidBeneficiary, ErrAA91FailedSendToBeneficiary, ErrAA92InternalCallOnly, ErrAA93InvalidPaymasterAndData,
+		ErrAA94GasValuesOverflow, ErrAA95OutOfGas, ErrAA96InvalidAggregator,
+	} {
+		aaErrors[aaErr.Code] = aaErr
+	}
+}
+
+// RPCError is returned when a JSON-RPC call to the network, bundler or paymaster fails.
+// When the server answered with a JSON-RPC error, Code, Message and Data are set and the error matches
+// the corresponding Err* sentinel of the code and the ErrAAxx sentinel of the reason with errors.Is.
+type RPCError struct {
+	Method  string
+	Code    int
+	Message string
+	Data    interface{}
+	AAError *AAError
+	// Revert is decoded with DefaultErrorRegistry when Data carries revert bytes
+	Revert *DecodedRevert
+	Err    error
+}
+
+func newRPCError(method string, err error) error {
+	rpcErr := &RPCError{
+		Method: method,
+		Err:    err,
+	}
+
+	var codeErr rpc.Error
+	if errors.As(err, &codeErr) {
+		rpcErr.Code = codeErr.ErrorCode()
+		rpcErr.Message = codeErr.Error()
+	}
+
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		rpcErr.Data = dataErr.ErrorData()
+	}
+
+	rpcErr.Revert = DefaultErrorRegistry.Decode(revertDataFromErrorData(rpcErr.Data))
+	rpcErr.AAError = parseAAError(rpcErr.Message, rpcErr.Data)
+	if rpcErr.AAError == nil && rpcErr.Revert != nil {
+		rpcErr.AAError = parseAAError(rpcErr.Revert.String(), nil)
+	}
+
+	return errors.WithStack(rpcErr)
+}
+
+// parseAAError finds the first AAxx reason code in the error message or data
+func parseAAError(message string, data interface{}) *AAError {
+	candidates := []string{message}
+	if data != nil {
+		candidates = append(candidates, fmt.Sprint(data))
+	}
+
+	for _, candidate := range candidates {
+		for _, code := range aaCodePattern.FindAllString(candidate, -1) {
+			if aaErr, ok := aaErrors[code]; ok {
+				return aaErr
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *RPCError) Error() string {
+	message := "failed to call " + e.Method + ": " + e.Err.Error()
+	if e.Revert != nil {
+		message += ": " + e.Revert.String()
+	}
+	return message
+}
+
+func (e *RPCError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel of the JSON-RPC error code and the AAxx sentinel of the reason
+func (e *RPCError) Is(target error) bool {
+	if e.AAError != nil && target == error(e.AAError) {
+		return true
+	}
+
+	codeErr, ok := rpcCodeErrors[e.Code]
+	return ok && target == codeErr
+}
+
+// As exposes the parsed AAError to errors.As
+func (e *RPCError) As(target interface{}) bool {
+	if aaTarget, ok := target.(**AAError); ok && e.AAError != nil {
+		*aaTarget = e.AAError
+		return true
+	}
+	return false
+}
+
+// PaymentError is returned when paying the user operation failed with its payment mode and the fallback payment modes.
+// Errors are the failures of the tried payment modes in order, errors.Is and errors.As match any of them.
+type PaymentError struct {
+	Modes  []PaymentMode
+	Errors []error
+}
+
+func (e *PaymentError) Error() string {
+	failures := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		failures[i] = string(e.Modes[i]) + ": " + err.Error()
+	}
+	return "failed to pay user operation: " + strings.Join(failures, "; ")
+}
+
+func (e *PaymentError) Unwrap() []error {
+	return e.Errors
+}
+
+// UserOperationError is returned together with the UserOperationResult when the user operation was submitted
+// but did not reach the included state. Status tells where in its lifecycle the user operation is.
+type UserOperationError struct {
+	UserOperationHash []byte
+	Status            UserOperationStatus
+	Err               error
+}
+
+func (e *UserOperationError) Error() string {
+	return "user operation " + hexutil.Encode(e.UserOperationHash) + " " + string(e.Status) + ": " + e.Err.Error()
+}
+
+func (e *UserOperationError) Unwrap() error {
+	return e.Err
+}
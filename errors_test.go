@@ -0,0 +1,80 @@
+package zerodev
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/friendsofgo/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonRPCError mimics the error returned by the go-ethereum rpc client for JSON-RPC error responses
+type jsonRPCError struct {
+	code    int
+	message string
+	data    interface{}
+}
+
+func (e *jsonRPCError) Error() string          { return e.message }
+func (e *jsonRPCError) ErrorCode() int         { return e.code }
+func (e *jsonRPCError) ErrorData() interface{} { return e.data }
+
+func TestRPCError_TypedErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		rpcErr          error
+		expectedIs      []error
+		expectedNotIs   []error
+		expectedAAError *AAError
+	}{
+		{
+			name:            "invalid_nonce",
+			rpcErr:          &jsonRPCError{code: -32500, message: "UserOperation reverted during simulation with reason: AA25 invalid account nonce"},
+			expectedIs:      []error{ErrRejectedByEntryPoint, ErrAA25InvalidNonce},
+			expectedNotIs:   []error{ErrRejectedByPaymaster, ErrAA21PrefundNotPaid},
+			expectedAAError: ErrAA25InvalidNonce,
+		},
+		{
+			name:            "paymaster_reverted_reason_in_data",
+			rpcErr:          &jsonRPCError{code: -32501, message: "paymaster validation failed", data: map[string]interface{}{"reason": "AA33 reverted"}},
+			expectedIs:      []error{ErrRejectedByPaymaster, ErrAA33PaymasterReverted},
+			expectedAAError: ErrAA33PaymasterReverted,
+		},
+		{
+			name:          "transport_failure",
+			rpcErr:        errors.New("dial tcp: connection refused"),
+			expectedNotIs: []error{ErrRejectedByEntryPoint, ErrAA25InvalidNonce},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundlerClient := newTestBundlerClient(t, &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					return tt.rpcErr
+				},
+			})
+
+			_, err := bundlerClient.SendUserOperation(&UserOperation{Sender: common.HexToAddress(AddressZero), Nonce: big.NewInt(0)})
+			require.Error(t, err)
+
+			for _, target := range tt.expectedIs {
+				assert.ErrorIs(t, err, target)
+			}
+			for _, target := range tt.expectedNotIs {
+				assert.NotErrorIs(t, err, target)
+			}
+
+			var aaErr *AAError
+			assert.Equal(t, tt.expectedAAError != nil, errors.As(err, &aaErr))
+			assert.Equal(t, tt.expectedAAError, aaErr)
+
+			var rpcErr *RPCError
+			require.ErrorAs(t, err, &rpcErr)
+			assert.Equal(t, "eth_sendUserOperation", rpcErr.Method)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package zerodev
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"sync"
+)
+
+const (
+	defaultGasTunerSmoothingFactor   = 0.2
+	defaultGasTunerMarginPercent     = 10
+	defaultGasTunerRevertBumpPercent = 20
+	defaultGasTunerMinPercent        = 100
+	defaultGasTunerMaxPercent        = 300
+)
+
+// GasLimitOptions overrides and scales the estimated gas limits of a user operation before the paymaster signs them.
+// Overrides take precedence over multipliers, multipliers are percentages of the estimate with 0 leaving it unchanged.
+type GasLimitOptions struct {
+	CallGasLimit                  *big.Int
+	VerificationGasLimit          *big.Int
+	PreVerificationGas            *big.Int
+	PaymasterVerificationGasLimit *big.Int
+	PaymasterPostOpGasLimit       *big.Int
+
+	CallGasMultiplierPercent            uint64
+	VerificationGasMultiplierPercent    uint64
+	PreVerificationGasMultiplierPercent uint64
+	// PaymasterGasMultiplierPercent scales both the paymaster verification and postOp gas limits
+	PaymasterGasMultiplierPercent uint64
+}
+
+// merge returns the options with the fields set in override replacing the ones of o
+func (o *GasLimitOptions) merge(override *GasLimitOptions) *GasLimitOptions {
+	if o == nil {
+		return override
+	}
+	if override == nil {
+		return o
+	}
+
+	merged := *o
+	for _, field := range []struct {
+		target **big.Int
+		value  *big.Int
+	}{
+		{&merged.CallGasLimit, override.CallGasLimit},
+		{&merged.VerificationGasLimit, override.VerificationGasLimit},
+		{&merged.PreVerificationGas, override.PreVerificationGas},
+		{&merged.PaymasterVerificationGasLimit, override.PaymasterVerificationGasLimit},
+		{&merged.PaymasterPostOpGasLimit, override.PaymasterPostOpGasLimit},
+	} {
+		if field.value != nil {
+			*field.target = field.value
+		}
+	}
+
+	for _, field := range []struct {
+		target *uint64
+		value  uint64
+	}{
+		{&merged.CallGasMultiplierPercent, override.CallGasMultiplierPercent},
+		{&merged.VerificationGasMultiplierPercent, override.VerificationGasMultiplierPercent},
+		{&merged.PreVerificationGasMultiplierPercent, override.PreVerificationGasMultiplierPercent},
+		{&merged.PaymasterGasMultiplierPercent, override.PaymasterGasMultiplierPercent},
+	} {
+		if field.value != 0 {
+			*field.target = field.value
+		}
+	}
+
+	return &merged
+}
+
+// empty returns whether the options neither override nor scale any gas limit
+func (o *GasLimitOptions) empty() bool {
+	return o == nil || *o == GasLimitOptions{}
+}
+
+// apply sets the overridden and scaled gas limits of the user operation, returns whether any limit changed
+func (o *GasLimitOptions) apply(op *UserOperation) bool {
+	if o == nil {
+		return false
+	}
+
+	var changed bool
+	for _, field := range []struct {
+		limit    **big.Int
+		override *big.Int
+		percent  uint64
+	}{
+		{&op.CallGasLimit, o.CallGasLimit, o.CallGasMultiplierPercent},
+		{&op.VerificationGasLimit, o.VerificationGasLimit, o.VerificationGasMultiplierPercent},
+		{&op.PreVerificationGas, o.PreVerificationGas, o.PreVerificationGasMultiplierPercent},
+		{&op.PaymasterVerificationGasLimit, o.PaymasterVerificationGasLimit, o.PaymasterGasMultiplierPercent},
+		{&op.PaymasterPostOpGasLimit, o.PaymasterPostOpGasLimit, o.PaymasterGasMultiplierPercent},
+	} {
+		var limit *big.Int
+		switch {
+		case field.override != nil:
+			limit = new(big.Int).Set(field.override)
+		case field.percent != 0 && *field.limit != nil:
+			limit = new(big.Int).Mul(*field.limit, new(big.Int).SetUint64(field.percent))
+			limit.Div(limit, big.NewInt(100))
+		default:
+			continue
+		}
+
+		if *field.limit == nil || (*field.limit).Cmp(limit) != 0 {
+			changed = true
+		}
+		*field.limit = limit
+	}
+
+	return changed
+}
+
+// GasTunerConfig controls how the GasTuner adapts the call gas multipliers
+type GasTunerConfig struct {
+	// SmoothingFactor is the weight of the newest observation in the moving average, 0.2 by default
+	SmoothingFactor float64
+	// MarginPercent is added to the observed multiplier, 10 by default
+	MarginPercent uint64
+	// RevertBumpPercent raises the multiplier after a reverted user operation, which may have run out of gas, 20 by default
+	RevertBumpPercent uint64
+	// MinPercent and MaxPercent bound the multiplier, 100 and 300 by default
+	MinPercent uint64
+	MaxPercent uint64
+}
+
+// GasTuner adapts the call gas multiplier per target and function selector from the gas used by included user operations.
+// Heavy calls get a higher multiplier after reverting or using most of their gas, calls using little gas get the minimum.
+type GasTuner struct {
+	config GasTunerConfig
+
+	mu    sync.Mutex
+	stats map[gasTunerKey]float64
+}
+
+// gasTunerKey is the target and the function selector of a call, the selector is empty for plain transfers
+type gasTunerKey struct {
+	Target   common.Address
+	Selector [4]byte
+}
+
+func NewGasTuner(config GasTunerConfig) (*GasTuner, error) {
+	if config.SmoothingFactor < 0 || config.SmoothingFactor > 1 {
+		return nil, errors.New("smoothing factor must be between 0 and 1")
+	}
+	if config.MaxPercent != 0 && config.MaxPercent < config.MinPercent {
+		return nil, errors.New("max percent must not be lower than min percent")
+	}
+
+	if config.SmoothingFactor == 0 {
+		config.SmoothingFactor = defaultGasTunerSmoothingFactor
+	}
+	if config.MarginPercent == 0 {
+		config.MarginPercent = defaultGasTunerMarginPercent
+	}
+	if config.RevertBumpPercent == 0 {
+		config.RevertBumpPercent = defaultGasTunerRevertBumpPercent
+	}
+	if config.MinPercent == 0 {
+		config.MinPercent = defaultGasTunerMinPercent
+	}
+	if config.MaxPercent == 0 {
+		config.MaxPercent = max(defaultGasTunerMaxPercent, config.MinPercent)
+	}
+
+	return &GasTuner{
+		config: config,
+		stats:  make(map[gasTunerKey]float64),
+	}, nil
+}
+
+// CallGasMultiplierPercent returns the multiplier for the Kernel execute call data, the highest one of its calls.
+// Returns false when none of the calls has been observed yet or the call data cannot be decoded.
+func (t *GasTuner) CallGasMultiplierPercent(callData []byte) (uint64, bool) {
+	keys := gasTunerKeys(callData)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var required float64
+	var found bool
+	for _, key := range keys {
+		if observed, ok := t.stats[key]; ok {
+			required = max(required, observed)
+			found = true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+
+	percent := uint64(required) + t.config.MarginPercent
+	return min(max(percent, t.config.MinPercent), t.config.MaxPercent), true
+}
+
+// Record observes the receipt of the user operation sent with the call gas multiplier appliedPercent
+func (t *GasTuner) Record(op *UserOperation, appliedPercent uint64, receipt *GetUserOperationReceiptResponse) {
+	if receipt == nil || receipt.ActualGasUsed == nil {
+		return
+	}
+	if appliedPercent == 0 {
+		appliedPercent = 100
+	}
+
+	var required float64
+	if receipt.Success {
+		// the share of the call gas limit actually used, scaled back to a multiplier of the estimate
+		if op.CallGasLimit == nil || op.CallGasLimit.Sign() == 0 {
+			return
+		}
+		utilization, _ := new(big.Rat).SetFrac(callGasUsed(op, receipt.ActualGasUsed.ToInt()), op.CallGasLimit).Float64()
+		required = utilization * float64(appliedPercent)
+	} else {
+		required = float64(appliedPercent * (100 + t.config.RevertBumpPercent) / 100)
+	}
+
+	keys := gasTunerKeys(op.CallData)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		observed, ok := t.stats[key]
+		if !ok {
+			t.stats[key] = required
+			continue
+		}
+		t.stats[key] = t.config.SmoothingFactor*required + (1-t.config.SmoothingFactor)*observed
+	}
+}
+
+func gasTunerKeys(callData []byte) []gasTunerKey {
+	calls, err := DecodeExecuteCall(callData)
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]gasTunerKey, 0, len(calls))
+	for _, call := range calls {
+		if call.To == nil {
+			continue
+		}
+
+		key := gasTunerKey{Target: *call.To}
+		if len(call.Data) >= 4 {
+			copy(key.Selector[:], call.Data[:4])
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// callGasUsed is the gas used by the call of the user operation, its total gas used minus the non-call limits.
+// The verification phases use at most their limits, so this is a lower bound which never raises the multiplier spuriously.
+func callGasUsed(op *UserOperation, actualGasUsed *big.Int) *big.Int {
+	used := new(big.Int).Set(actualGasUsed)
+	for _, limit := range []*big.Int{op.PreVerificationGas, op.VerificationGasLimit, op.PaymasterVerificationGasLimit, op.PaymasterPostOpGasLimit} {
+		if limit != nil {
+			used.Sub(used, limit)
+		}
+	}
+	if used.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	return used
+}
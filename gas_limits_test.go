@@ -0,0 +1,266 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGasLimitOptions_Apply(t *testing.T) {
+	tests := []struct {
+		name            string
+		clientOptions   *GasLimitOptions
+		opOptions       *GasLimitOptions
+		expectedChanged bool
+		expectedCallGas *big.Int
+		expectedPreGas  *big.Int
+		expectedPmGas   *big.Int
+	}{
+		{
+			name:            "none",
+			expectedCallGas: big.NewInt(1000),
+			expectedPreGas:  big.NewInt(500),
+			expectedPmGas:   big.NewInt(200),
+		},
+		{
+			name:            "client_multipliers",
+			clientOptions:   &GasLimitOptions{CallGasMultiplierPercent: 150, PaymasterGasMultiplierPercent: 110},
+			expectedChanged: true,
+			expectedCallGas: big.NewInt(1500),
+			expectedPreGas:  big.NewInt(500),
+			expectedPmGas:   big.NewInt(220),
+		},
+		{
+			name:            "operation_override_takes_precedence",
+			clientOptions:   &GasLimitOptions{CallGasMultiplierPercent: 150, PreVerificationGasMultiplierPercent: 120},
+			opOptions:       &GasLimitOptions{CallGasLimit: big.NewInt(5000)},
+			expectedChanged: true,
+			expectedCallGas: big.NewInt(5000),
+			expectedPreGas:  big.NewInt(600),
+			expectedPmGas:   big.NewInt(200),
+		},
+		{
+			name:            "unchanged_override",
+			opOptions:       &GasLimitOptions{CallGasLimit: big.NewInt(1000)},
+			expectedCallGas: big.NewInt(1000),
+			expectedPreGas:  big.NewInt(500),
+			expectedPmGas:   big.NewInt(200),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &UserOperation{
+				CallGasLimit:                  big.NewInt(1000),
+				VerificationGasLimit:          big.NewInt(800),
+				PreVerificationGas:            big.NewInt(500),
+				PaymasterVerificationGasLimit: big.NewInt(200),
+			}
+
+			changed := tt.clientOptions.merge(tt.opOptions).apply(op)
+
+			assert.Equal(t, tt.expectedChanged, changed)
+			assert.Equal(t, tt.expectedCallGas, op.CallGasLimit)
+			assert.Equal(t, big.NewInt(800), op.VerificationGasLimit)
+			assert.Equal(t, tt.expectedPreGas, op.PreVerificationGas)
+			assert.Equal(t, tt.expectedPmGas, op.PaymasterVerificationGasLimit)
+			assert.Nil(t, op.PaymasterPostOpGasLimit)
+		})
+	}
+}
+
+func TestGasTuner(t *testing.T) {
+	heavyTarget := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	lightTarget := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+
+	encode := func(t *testing.T, msgs ...ethereum.CallMsg) []byte {
+		callData, err := EncodeExecuteBatchCall(msgs)
+		require.NoError(t, err)
+		return *callData
+	}
+	heavyCall := ethereum.CallMsg{To: &heavyTarget, Value: big.NewInt(0), Data: common.FromHex("0x12345678")}
+	lightCall := ethereum.CallMsg{To: &lightTarget, Value: big.NewInt(0), Data: common.FromHex("0x87654321")}
+
+	tuner, err := NewGasTuner(GasTunerConfig{SmoothingFactor: 0.5})
+	require.NoError(t, err)
+
+	_, ok := tuner.CallGasMultiplierPercent(encode(t, heavyCall))
+	assert.False(t, ok)
+
+	op := func(callData []byte) *UserOperation {
+		return &UserOperation{CallData: callData, CallGasLimit: big.NewInt(1000)}
+	}
+	receipt := func(success bool, gasUsed int64) *GetUserOperationReceiptResponse {
+		return &GetUserOperationReceiptResponse{Success: success, ActualGasUsed: (*hexutil.Big)(big.NewInt(gasUsed))}
+	}
+
+	// light calls use little of their limit and keep the minimum multiplier
+	tuner.Record(op(encode(t, lightCall)), 0, receipt(true, 400))
+	percent, ok := tuner.CallGasMultiplierPercent(encode(t, lightCall))
+	require.True(t, ok)
+	assert.Equal(t, uint64(100), percent)
+
+	// a reverted heavy call raises its multiplier by the bump and the margin
+	tuner.Record(op(encode(t, heavyCall)), 0, receipt(false, 1000))
+	percent, ok = tuner.CallGasMultiplierPercent(encode(t, heavyCall))
+	require.True(t, ok)
+	assert.Equal(t, uint64(130), percent)
+
+	// sent with 130%, the heavy call used all of its gas: (120 + 130) / 2 + 10
+	tuner.Record(op(encode(t, heavyCall)), 130, receipt(true, 1000))
+	percent, ok = tuner.CallGasMultiplierPercent(encode(t, heavyCall))
+	require.True(t, ok)
+	assert.Equal(t, uint64(135), percent)
+
+	// batches use the highest multiplier of their calls
+	percent, ok = tuner.CallGasMultiplierPercent(encode(t, lightCall, heavyCall))
+	require.True(t, ok)
+	assert.Equal(t, uint64(135), percent)
+}
+
+func TestGasTuner_Record_VerificationGas(t *testing.T) {
+	target := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	callData, err := EncodeExecuteCall(&ethereum.CallMsg{To: &target, Value: big.NewInt(0), Data: common.FromHex("0x12345678")})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		actualGasUsed   int64
+		expectedPercent uint64
+	}{
+		{
+			// 50k preVerificationGas, 190k verification and postOp, 60k call: 60% of the call gas limit
+			name:            "light_call",
+			actualGasUsed:   300000,
+			expectedPercent: 70,
+		},
+		{
+			name:            "heavy_call",
+			actualGasUsed:   335000,
+			expectedPercent: 105,
+		},
+		{
+			name:            "verification_below_limits",
+			actualGasUsed:   200000,
+			expectedPercent: 50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuner, err := NewGasTuner(GasTunerConfig{MinPercent: 50})
+			require.NoError(t, err)
+
+			op := &UserOperation{
+				CallData:                      *callData,
+				PreVerificationGas:            big.NewInt(50000),
+				VerificationGasLimit:          big.NewInt(150000),
+				CallGasLimit:                  big.NewInt(100000),
+				PaymasterVerificationGasLimit: big.NewInt(30000),
+				PaymasterPostOpGasLimit:       big.NewInt(10000),
+			}
+			tuner.Record(op, 0, &GetUserOperationReceiptResponse{Success: true, ActualGasUsed: (*hexutil.Big)(big.NewInt(tt.actualGasUsed))})
+
+			percent, ok := tuner.CallGasMultiplierPercent(*callData)
+			require.True(t, ok)
+			assert.Equal(t, tt.expectedPercent, percent)
+		})
+	}
+}
+
+func TestPaymasterClient_SponsorUserOperationWithOptions_GasLimits(t *testing.T) {
+	estimated := `{"callGasLimit":"0x3e8","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+	adjusted := `{"callGasLimit":"0x5dc","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x02","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+	shouldConsume := false
+
+	tests := []struct {
+		name                  string
+		options               *SponsorshipOptions
+		adjustedResponse      string
+		expectedShouldConsume []bool
+		expectedCallGasLimits []*big.Int
+		expectedPaymasterData []byte
+		expectedErr           error
+	}{
+		{
+			name:                  "without_gas_limits",
+			options:               &SponsorshipOptions{},
+			expectedShouldConsume: []bool{true},
+			expectedCallGasLimits: []*big.Int{nil},
+			expectedPaymasterData: []byte{0x01},
+		},
+		{
+			name:                  "adjusted",
+			options:               &SponsorshipOptions{GasLimits: &GasLimitOptions{CallGasMultiplierPercent: 150}},
+			adjustedResponse:      adjusted,
+			expectedShouldConsume: []bool{false, true},
+			expectedCallGasLimits: []*big.Int{nil, big.NewInt(1500)},
+			expectedPaymasterData: []byte{0x02},
+		},
+		{
+			name:                  "unchanged_without_consume",
+			options:               &SponsorshipOptions{GasLimits: &GasLimitOptions{CallGasLimit: big.NewInt(1000)}, ShouldConsume: &shouldConsume},
+			expectedShouldConsume: []bool{false},
+			expectedCallGasLimits: []*big.Int{nil},
+			expectedPaymasterData: []byte{0x01},
+		},
+		{
+			name:                  "adjusted_limits_not_sponsored",
+			options:               &SponsorshipOptions{GasLimits: &GasLimitOptions{CallGasMultiplierPercent: 150}},
+			adjustedResponse:      estimated,
+			expectedShouldConsume: []bool{false, true},
+			expectedCallGasLimits: []*big.Int{nil, big.NewInt(1500)},
+			expectedErr:           ErrSponsoredGasLimitsMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []SponsorUserOperationRequest
+			rpcClient := &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					request := args[0].(SponsorUserOperationRequest)
+					operation := *request.Operation
+					request.Operation = &operation
+					requests = append(requests, request)
+
+					response := estimated
+					if request.Operation.CallGasLimit != nil {
+						response = tt.adjustedResponse
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			}
+
+			bundlerClient := newTestBundlerClient(t, rpcClient)
+			paymasterClient, err := NewPaymasterClient(rpcClient, bundlerClient.EntryPoint, bundlerClient.ChainID)
+			require.NoError(t, err)
+
+			op := &UserOperation{Sender: common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"), Nonce: big.NewInt(1), MaxFeePerGas: big.NewInt(100), MaxPriorityFeePerGas: big.NewInt(10)}
+			response, err := paymasterClient.SponsorUserOperationWithOptions(op, tt.options)
+
+			require.Len(t, requests, len(tt.expectedShouldConsume))
+			for i, request := range requests {
+				assert.Equal(t, tt.expectedShouldConsume[i], request.ShouldConsume)
+				assert.Equal(t, tt.expectedCallGasLimits[i], request.Operation.CallGasLimit)
+				assert.Empty(t, request.Operation.Paymaster)
+				assert.Equal(t, big.NewInt(100), request.Operation.MaxFeePerGas)
+			}
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedPaymasterData, response.PaymasterData)
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package zerodev
+
+import (
+	"context"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/friendsofgo/errors"
+	"math/big"
+)
+
+// GasPriceTier selects how fast the user operation is expected to be included, at the matching price
+type GasPriceTier string
+
+const (
+	GasPriceTierSlow     GasPriceTier = "slow"
+	GasPriceTierStandard GasPriceTier = "standard"
+	GasPriceTierFast     GasPriceTier = "fast"
+)
+
+// defaultFeeHistoryBlockCount is the number of blocks the fee history oracle averages the priority fees of
+const defaultFeeHistoryBlockCount = 10
+
+// feeHistoryPercentiles are the reward percentiles of the slow, standard and fast tiers
+var feeHistoryPercentiles = []float64{25, 50, 75}
+
+// GasPriceOracle provides the fees of user operations
+type GasPriceOracle interface {
+	GetGasPrice(tier GasPriceTier) (*GasPriceSpecification, error)
+	GetGasPriceContext(ctx context.Context, tier GasPriceTier) (*GasPriceSpecification, error)
+}
+
+// ZeroDevGasPriceOracle takes the fees from zd_getUserOperationGasPrice of the ZeroDev bundler
+type ZeroDevGasPriceOracle struct {
+	Bundler *BundlerClient
+}
+
+func NewZeroDevGasPriceOracle(bundler *BundlerClient) (*ZeroDevGasPriceOracle, error) {
+	if bundler == nil {
+		return nil, errors.New("bundler is required")
+	}
+
+	return &ZeroDevGasPriceOracle{
+		Bundler: bundler,
+	}, nil
+}
+
+func (o *ZeroDevGasPriceOracle) GetGasPrice(tier GasPriceTier) (*GasPriceSpecification, error) {
+	return o.GetGasPriceContext(context.Background(), tier)
+}
+
+func (o *ZeroDevGasPriceOracle) GetGasPriceContext(ctx context.Context, tier GasPriceTier) (*GasPriceSpecification, error) {
+	gasPrice, err := o.Bundler.GetUserOperationGasPriceContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return gasPrice.tier(tier)
+}
+
+// PimlicoGasPriceOracle takes the fees from pimlico_getUserOperationGasPrice of the Pimlico bundler
+type PimlicoGasPriceOracle struct {
+	Client types.RPCClient
+}
+
+func NewPimlicoGasPriceOracle(rpcClient types.RPCClient) (*PimlicoGasPriceOracle, error) {
+	if rpcClient == nil {
+		return nil, errors.New("rpcClient is required")
+	}
+
+	return &PimlicoGasPriceOracle{
+		Client: rpcClient,
+	}, nil
+}
+
+func (o *PimlicoGasPriceOracle) GetGasPrice(tier GasPriceTier) (*GasPriceSpecification, error) {
+	return o.GetGasPriceContext(context.Background(), tier)
+}
+
+func (o *PimlicoGasPriceOracle) GetGasPriceContext(ctx context.Context, tier GasPriceTier) (*GasPriceSpecification, error) {
+	var gasPrice GetUserOperationGasPriceResponse
+
+	if err := o.Client.CallContext(ctx, &gasPrice, "pimlico_getUserOperationGasPrice"); err != nil {
+		return nil, newRPCError("pimlico_getUserOperationGasPrice", err)
+	}
+
+	return gasPrice.tier(tier)
+}
+
+// FeeHistoryResponse is the result of eth_feeHistory
+type FeeHistoryResponse struct {
+	OldestBlock   *hexutil.Big     `json:"oldestBlock"`
+	BaseFeePerGas []*hexutil.Big   `json:"baseFeePerGas"`
+	GasUsedRatio  []float64        `json:"gasUsedRatio"`
+	Reward        [][]*hexutil.Big `json:"reward"`
+}
+
+// FeeHistoryGasPriceOracle computes the fees from eth_feeHistory of the network RPC, independently of the bundler.
+// The priority fee is the average reward percentile of the tier (25th, 50th, 75th) over the last blocks and
+// the max fee covers twice the base fee of the next block.
+type FeeHistoryGasPriceOracle struct {
+	Client     types.RPCClient
+	BlockCount uint64
+}
+
+// NewFeeHistoryGasPriceOracle creates the oracle averaging the priority fees of the last blockCount blocks, 10 when zero
+func NewFeeHistoryGasPriceOracle(rpcClient types.RPCClient, blockCount uint64) (*FeeHistoryGasPriceOracle, error) {
+	if rpcClient == nil {
+		return nil, errors.New("rpcClient is required")
+	}
+
+	if blockCount == 0 {
+		blockCount = defaultFeeHistoryBlockCount
+	}
+
+	return &FeeHistoryGasPriceOracle{
+		Client:     rpcClient,
+		BlockCount: blockCount,
+	}, nil
+}
+
+func (o *FeeHistoryGasPriceOracle) GetGasPrice(tier GasPriceTier) (*GasPriceSpecification, error) {
+	return o.GetGasPriceContext(context.Background(), tier)
+}
+
+func (o *FeeHistoryGasPriceOracle) GetGasPriceContext(ctx context.Context, tier GasPriceTier) (*GasPriceSpecification, error) {
+	var percentile int
+	switch tier {
+	case GasPriceTierSlow:
+		percentile = 0
+	case GasPriceTierStandard, "":
+		percentile = 1
+	case GasPriceTierFast:
+		percentile = 2
+	default:
+		return nil, errors.Errorf("unsupported gas price tier: %s", tier)
+	}
+
+	var feeHistory FeeHistoryResponse
+	err := o.Client.CallContext(ctx, &feeHistory, "eth_feeHistory", hexutil.Uint64(o.BlockCount), BlockTagLatest, feeHistoryPercentiles)
+	if err != nil {
+		return nil, newRPCError("eth_feeHistory", err)
+	}
+
+	if len(feeHistory.BaseFeePerGas) == 0 {
+		return nil, errors.New("fee history without base fee")
+	}
+
+	// the last base fee is the one of the next block
+	baseFee := feeHistory.BaseFeePerGas[len(feeHistory.BaseFeePerGas)-1].ToInt()
+
+	priorityFee := big.NewInt(0)
+	var rewardCount int64
+	for _, reward := range feeHistory.Reward {
+		if len(reward) > percentile && reward[percentile] != nil {
+			priorityFee.Add(priorityFee, reward[percentile].ToInt())
+			rewardCount++
+		}
+	}
+	if rewardCount > 0 {
+		priorityFee.Div(priorityFee, big.NewInt(rewardCount))
+	}
+
+	maxFee := new(big.Int).Mul(baseFee, big.NewInt(2))
+	maxFee.Add(maxFee, priorityFee)
+
+	return &GasPriceSpecification{
+		MaxPriorityFeePerGas: priorityFee,
+		MaxFeePerGas:         maxFee,
+	}, nil
+}
+
+// FallbackGasPriceOracle asks the oracles in order and returns the first gas price, e.g. to keep sending
+// with the fee history of the network RPC when the bundler gas price endpoint is down
+type FallbackGasPriceOracle struct {
+	Oracles []GasPriceOracle
+}
+
+func NewFallbackGasPriceOracle(oracles ...GasPriceOracle) (*FallbackGasPriceOracle, error) {
+	if len(oracles) == 0 {
+		return nil, errors.New("at least one oracle is required")
+	}
+
+	return &FallbackGasPriceOracle{
+		Oracles: oracles,
+	}, nil
+}
+
+func (o *FallbackGasPriceOracle) GetGasPrice(tier GasPriceTier) (*GasPriceSpecification, error) {
+	return o.GetGasPriceContext(context.Background(), tier)
+}
+
+func (o *FallbackGasPriceOracle) GetGasPriceContext(ctx context.Context, tier GasPriceTier) (*GasPriceSpecification, error) {
+	var err error
+	for _, oracle := range o.Oracles {
+		var gasPrice *GasPriceSpecification
+		if gasPrice, err = oracle.GetGasPriceContext(ctx, tier); err == nil {
+			return gasPrice, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, errors.Wrap(err, "all gas price oracles failed")
+}
+
+// newDefaultGasPriceOracle asks the ZeroDev bundler and falls back to the fee history of the network RPC
+func newDefaultGasPriceOracle(bundler *BundlerClient, rpcClient types.RPCClient) (*FallbackGasPriceOracle, error) {
+	zeroDevOracle, err := NewZeroDevGasPriceOracle(bundler)
+	if err != nil {
+		return nil, err
+	}
+
+	feeHistoryOracle, err := NewFeeHistoryGasPriceOracle(rpcClient, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFallbackGasPriceOracle(zeroDevOracle, feeHistoryOracle)
+}
+
+// tier returns the gas price of the tier, standard when empty
+func (g *GetUserOperationGasPriceResponse) tier(tier GasPriceTier) (*GasPriceSpecification, error) {
+	if tier == "" {
+		tier = GasPriceTierStandard
+	}
+
+	var gasPrice *GasPriceSpecification
+	switch tier {
+	case GasPriceTierSlow:
+		gasPrice = g.Slow
+	case GasPriceTierStandard:
+		gasPrice = g.Standard
+	case GasPriceTierFast:
+		gasPrice = g.Fast
+	default:
+		return nil, errors.Errorf("unsupported gas price tier: %s", tier)
+	}
+
+	if gasPrice == nil {
+		return nil, errors.Errorf("gas price of tier %s not available", tier)
+	}
+
+	return gasPrice, nil
+}
@@ -0,0 +1,140 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGasPriceResponse = `{"slow":{"maxFeePerGas":"0x64","maxPriorityFeePerGas":"0xa"},"standard":{"maxFeePerGas":"0xc8","maxPriorityFeePerGas":"0x14"},"fast":{"maxFeePerGas":"0x12c","maxPriorityFeePerGas":"0x1e"}}`
+
+func TestGasPriceOracles(t *testing.T) {
+	tests := []struct {
+		name             string
+		newOracle        func(rpcClient *mockRPCClient) (GasPriceOracle, error)
+		responses        map[string]string
+		tier             GasPriceTier
+		expectedGasPrice *GasPriceSpecification
+	}{
+		{
+			name: "zerodev_fast",
+			newOracle: func(rpcClient *mockRPCClient) (GasPriceOracle, error) {
+				return NewZeroDevGasPriceOracle(newTestBundlerClient(t, rpcClient))
+			},
+			responses:        map[string]string{"zd_getUserOperationGasPrice": testGasPriceResponse},
+			tier:             GasPriceTierFast,
+			expectedGasPrice: &GasPriceSpecification{MaxFeePerGas: big.NewInt(300), MaxPriorityFeePerGas: big.NewInt(30)},
+		},
+		{
+			name: "pimlico_slow",
+			newOracle: func(rpcClient *mockRPCClient) (GasPriceOracle, error) {
+				return NewPimlicoGasPriceOracle(rpcClient)
+			},
+			responses:        map[string]string{"pimlico_getUserOperationGasPrice": testGasPriceResponse},
+			tier:             GasPriceTierSlow,
+			expectedGasPrice: &GasPriceSpecification{MaxFeePerGas: big.NewInt(100), MaxPriorityFeePerGas: big.NewInt(10)},
+		},
+		{
+			name: "fee_history_standard",
+			newOracle: func(rpcClient *mockRPCClient) (GasPriceOracle, error) {
+				return NewFeeHistoryGasPriceOracle(rpcClient, 2)
+			},
+			responses:        map[string]string{"eth_feeHistory": `{"oldestBlock":"0x10","baseFeePerGas":["0x64","0x6e","0x78"],"gasUsedRatio":[0.5,0.6],"reward":[["0x1","0xa","0x14"],["0x2","0x14","0x28"]]}`},
+			tier:             GasPriceTierStandard,
+			expectedGasPrice: &GasPriceSpecification{MaxFeePerGas: big.NewInt(2*120 + 15), MaxPriorityFeePerGas: big.NewInt(15)},
+		},
+		{
+			name: "fallback_to_fee_history",
+			newOracle: func(rpcClient *mockRPCClient) (GasPriceOracle, error) {
+				return newDefaultGasPriceOracle(newTestBundlerClient(t, rpcClient), rpcClient)
+			},
+			responses:        map[string]string{"eth_feeHistory": `{"oldestBlock":"0x10","baseFeePerGas":["0x64","0x64"],"gasUsedRatio":[0.5],"reward":[["0x1","0xa","0x14"]]}`},
+			tier:             GasPriceTierFast,
+			expectedGasPrice: &GasPriceSpecification{MaxFeePerGas: big.NewInt(2*100 + 20), MaxPriorityFeePerGas: big.NewInt(20)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rpcClient := &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					response, ok := tt.responses[method]
+					if !ok {
+						return &jsonRPCError{code: -32601, message: "method not found"}
+					}
+					if method == "eth_feeHistory" {
+						require.Len(t, args, 3)
+						assert.Equal(t, BlockTagLatest, args[1])
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			}
+
+			oracle, err := tt.newOracle(rpcClient)
+			require.NoError(t, err)
+
+			gasPrice, err := oracle.GetGasPriceContext(context.Background(), tt.tier)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedGasPrice, gasPrice)
+		})
+	}
+}
+
+func TestClient_GetUserOperationAndHashToSignWithOptions_GasPrice(t *testing.T) {
+	sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+
+	tests := []struct {
+		name                 string
+		options              *UserOperationOptions
+		clientCeiling        *big.Int
+		expectedMaxFeePerGas *big.Int
+		expectedErr          error
+	}{
+		{
+			name:                 "standard_by_default",
+			expectedMaxFeePerGas: big.NewInt(200),
+		},
+		{
+			name:                 "tier_per_operation",
+			options:              &UserOperationOptions{GasPriceTier: GasPriceTierFast},
+			expectedMaxFeePerGas: big.NewInt(300),
+		},
+		{
+			name:          "client_ceiling_exceeded",
+			clientCeiling: big.NewInt(150),
+			expectedErr:   ErrMaxFeePerGasExceeded,
+		},
+		{
+			name:                 "ceiling_per_operation",
+			options:              &UserOperationOptions{GasPriceTier: GasPriceTierSlow, MaxFeePerGas: big.NewInt(100)},
+			clientCeiling:        big.NewInt(50),
+			expectedMaxFeePerGas: big.NewInt(100),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, jsonResponses(map[string]string{
+				"eth_call":                    `"0x0000000000000000000000000000000000000000000000000000000000000001"`,
+				"zd_getUserOperationGasPrice": testGasPriceResponse,
+				"zd_sponsorUserOperation":     `{"callGasLimit":"0x3f7e","verificationGasLimit":"0x1079b","preVerificationGas":"0xd3e3","paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`,
+			}))
+			client.MaxFeePerGas = tt.clientCeiling
+
+			callData := common.FromHex("0x1234")
+			op, _, err := client.GetUserOperationAndHashToSignWithOptions(sender, &callData, tt.options)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedMaxFeePerGas, op.MaxFeePerGas)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/friendsofgo/errors"
+	"math/big"
 	"strings"
 )
 
@@ -30,7 +31,8 @@ func EncodeExecuteCall(msg *ethereum.CallMsg) (*[]byte, error) {
 
 	data := bytes.Buffer{}
 	data.Write(msg.To.Bytes())
-	data.Write(common.RightPadBytes(msg.Value.Bytes(), 32))
+	// Kernel reads the value as a big-endian uint256
+	data.Write(common.LeftPadBytes(msg.Value.Bytes(), 32))
 	data.Write(msg.Data)
 
 	execMode := bytes.Buffer{}
@@ -50,3 +52,161 @@ func EncodeExecuteCall(msg *ethereum.CallMsg) (*[]byte, error) {
 
 	return &callData, nil
 }
+
+const kernelInvalidateNonceABI = `[{
+        "type": "function",
+        "name": "invalidateNonce",
+        "inputs": [
+            { "name": "nonce", "type": "uint32", "internalType": "uint32" }
+        ],
+        "outputs": [],
+        "stateMutability": "payable"
+    }]`
+
+// EncodeInvalidateNonceCall creates the call of the Kernel account to itself invalidating all validation nonces below nonce,
+// which revokes validators and permissions enabled with signatures of the invalidated nonces
+func EncodeInvalidateNonceCall(account common.Address, nonce uint32) (*ethereum.CallMsg, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(kernelInvalidateNonceABI))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse invalidateNonce abi")
+	}
+
+	data, err := parsedABI.Pack("invalidateNonce", nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack invalidateNonce call data")
+	}
+
+	return &ethereum.CallMsg{
+		To:    &account,
+		Value: big.NewInt(0),
+		Data:  data,
+	}, nil
+}
+
+const (
+	kernelCallTypeSingle = byte(0x00)
+	kernelCallTypeBatch  = byte(0x01)
+)
+
+type kernelExecution struct {
+	Target   common.Address
+	Value    *big.Int
+	CallData []byte
+}
+
+var kernelExecutionsType = mustKernelExecutionsType()
+
+// EncodeExecuteBatchCall encodes calls as Kernel execute call data using the batch call type
+func EncodeExecuteBatchCall(msgs []ethereum.CallMsg) (*[]byte, error) {
+	if len(msgs) == 0 {
+		return nil, errors.New("at least one call is required")
+	}
+
+	parsedABI, err := abi.JSON(strings.NewReader(kernelAccountExecuteABI))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse execute call abi")
+	}
+
+	executions := make([]kernelExecution, len(msgs))
+	for i, msg := range msgs {
+		executions[i] = kernelExecution{
+			Value:    big.NewInt(0),
+			CallData: msg.Data,
+		}
+		if msg.To != nil {
+			executions[i].Target = *msg.To
+		}
+		if msg.Value != nil {
+			executions[i].Value = msg.Value
+		}
+		if executions[i].CallData == nil {
+			executions[i].CallData = []byte{}
+		}
+	}
+
+	data, err := abi.Arguments{{Type: kernelExecutionsType}}.Pack(executions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode batch executions")
+	}
+
+	var execMode [32]byte
+	execMode[0] = kernelCallTypeBatch
+
+	callData, err := parsedABI.Pack("execute", execMode, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode execute call data")
+	}
+
+	return &callData, nil
+}
+
+// DecodeExecuteCall decodes the calls of Kernel execute call data encoded by EncodeExecuteCall or EncodeExecuteBatchCall
+func DecodeExecuteCall(callData []byte) ([]ethereum.CallMsg, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(kernelAccountExecuteABI))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse execute call abi")
+	}
+
+	method := parsedABI.Methods["execute"]
+	if len(callData) < 4 || !bytes.Equal(callData[:4], method.ID) {
+		return nil, errors.New("call data is not a kernel execute call")
+	}
+
+	args, err := method.Inputs.Unpack(callData[4:])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode execute call data")
+	}
+
+	execMode := args[0].([32]byte)
+	data := args[1].([]byte)
+
+	switch execMode[0] {
+	case kernelCallTypeSingle:
+		if len(data) < common.AddressLength+32 {
+			return nil, errors.New("single execution call data is too short")
+		}
+
+		target := common.BytesToAddress(data[:common.AddressLength])
+		return []ethereum.CallMsg{{
+			To:    &target,
+			Value: big.NewInt(0).SetBytes(data[common.AddressLength : common.AddressLength+32]),
+			Data:  data[common.AddressLength+32:],
+		}}, nil
+	case kernelCallTypeBatch:
+		executionsArgs := abi.Arguments{{Type: kernelExecutionsType}}
+		unpacked, err := executionsArgs.Unpack(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode batch executions")
+		}
+
+		var executions []kernelExecution
+		if err := executionsArgs.Copy(&executions, unpacked); err != nil {
+			return nil, errors.Wrap(err, "failed to decode batch executions")
+		}
+
+		msgs := make([]ethereum.CallMsg, len(executions))
+		for i, execution := range executions {
+			target := execution.Target
+			msgs[i] = ethereum.CallMsg{
+				To:    &target,
+				Value: execution.Value,
+				Data:  execution.CallData,
+			}
+		}
+		return msgs, nil
+	default:
+		return nil, errors.Errorf("unsupported call type: %#x", execMode[0])
+	}
+}
+
+func mustKernelExecutionsType() abi.Type {
+	executionsType, err := abi.NewType("tuple[]", "", []abi.ArgumentMarshaling{
+		{Name: "target", Type: "address"},
+		{Name: "value", Type: "uint256"},
+		{Name: "callData", Type: "bytes"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return executionsType
+}
@@ -0,0 +1,54 @@
+package zerodev
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeExecuteCall(t *testing.T) {
+	target := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	msgs := []ethereum.CallMsg{
+		{To: &target, Value: big.NewInt(1e18), Data: common.FromHex("0x1234")},
+		{To: &other, Value: big.NewInt(0), Data: []byte{}},
+	}
+
+	tests := []struct {
+		name   string
+		encode func() (*[]byte, error)
+		msgs   []ethereum.CallMsg
+	}{
+		{
+			name:   "single",
+			encode: func() (*[]byte, error) { return EncodeExecuteCall(&msgs[0]) },
+			msgs:   msgs[:1],
+		},
+		{
+			name:   "batch",
+			encode: func() (*[]byte, error) { return EncodeExecuteBatchCall(msgs) },
+			msgs:   msgs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callData, err := tt.encode()
+			require.NoError(t, err)
+
+			calls, err := DecodeExecuteCall(*callData)
+			require.NoError(t, err)
+
+			require.Len(t, calls, len(tt.msgs))
+			for i, msg := range tt.msgs {
+				assert.Equal(t, *msg.To, *calls[i].To)
+				assert.Zero(t, msg.Value.Cmp(calls[i].Value))
+				assert.Equal(t, msg.Data, calls[i].Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package zerodev
+
+import (
+	"context"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+)
+
+const (
+	BlockTagLatest    = "latest"
+	BlockTagFinalized = "finalized"
+)
+
+type blockHeader struct {
+	Number *hexutil.Big `json:"number"`
+	Hash   common.Hash  `json:"hash"`
+}
+
+// getBlockHeader returns number and hash of the block identified by a tag or hex number, nil when the block does not exist
+func getBlockHeader(ctx context.Context, client types.RPCClient, block string) (*blockHeader, error) {
+	var header *blockHeader
+
+	err := client.CallContext(ctx, &header, "eth_getBlockByNumber", block, false)
+	if err != nil {
+		return nil, newRPCError("eth_getBlockByNumber", err)
+	}
+
+	return header, nil
+}
+
+func getBlockNumber(ctx context.Context, client types.RPCClient) (*big.Int, error) {
+	var number hexutil.Big
+
+	err := client.CallContext(ctx, &number, "eth_blockNumber")
+	if err != nil {
+		return nil, newRPCError("eth_blockNumber", err)
+	}
+
+	return number.ToInt(), nil
+}
+
+// getBalance returns the native balance of the account at the latest block
+func getBalance(ctx context.Context, client types.RPCClient, account common.Address) (*big.Int, error) {
+	var balance hexutil.Big
+
+	err := client.CallContext(ctx, &balance, "eth_getBalance", account, BlockTagLatest)
+	if err != nil {
+		return nil, newRPCError("eth_getBalance", err)
+	}
+
+	return balance.ToInt(), nil
+}
@@ -0,0 +1,54 @@
+package zerodev
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/friendsofgo/errors"
+	"hash/fnv"
+	"math/big"
+	"sync/atomic"
+)
+
+// nonceLaneShift places the lane above the bits of computeKey in the 192 bit nonce key
+const nonceLaneShift = 64
+
+// LaneScheduler spreads the user operations of an account over several nonce keys, called lanes.
+// The EntryPoint orders user operations only within a nonce key, so user operations in different lanes are not
+// serialized behind each other. Lane 0 is the nonce key of computeKey, the one used without a LaneScheduler.
+type LaneScheduler struct {
+	Lanes uint64
+
+	next atomic.Uint64
+}
+
+func NewLaneScheduler(lanes uint64) (*LaneScheduler, error) {
+	if lanes == 0 {
+		return nil, errors.New("at least one lane is required")
+	}
+
+	return &LaneScheduler{
+		Lanes: lanes,
+	}, nil
+}
+
+// Lane returns the lane of the next user operation. User operations with the same non-empty ordering key are pinned
+// to the same lane and included in the order they were prepared in, the others are spread over the lanes round robin.
+func (s *LaneScheduler) Lane(orderingKey string) uint64 {
+	if orderingKey != "" {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(orderingKey))
+		return hash.Sum64() % s.Lanes
+	}
+
+	return (s.next.Add(1) - 1) % s.Lanes
+}
+
+// NonceKey returns the 192 bit nonce key of the sender for the lane of the next user operation
+func (s *LaneScheduler) NonceKey(sender common.Address, orderingKey string) *big.Int {
+	return laneNonceKey(sender, s.Lane(orderingKey))
+}
+
+// laneNonceKey returns the 192 bit nonce key of the sender in the lane, lane 0 is the default nonce key of the sender
+func laneNonceKey(sender common.Address, lane uint64) *big.Int {
+	key := new(big.Int).Lsh(new(big.Int).SetUint64(lane), nonceLaneShift)
+	return key.Or(key, computeKey(sender))
+}
@@ -0,0 +1,47 @@
+package zerodev
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaneScheduler_Lane(t *testing.T) {
+	_, err := NewLaneScheduler(0)
+	require.Error(t, err)
+
+	scheduler, err := NewLaneScheduler(4)
+	require.NoError(t, err)
+
+	// unpinned user operations use every lane
+	var lanes []uint64
+	for i := 0; i < 8; i++ {
+		lanes = append(lanes, scheduler.Lane(""))
+	}
+	assert.Equal(t, []uint64{0, 1, 2, 3, 0, 1, 2, 3}, lanes)
+
+	// user operations with the same ordering key stay in one lane
+	pinned := scheduler.Lane("invoice-42")
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, pinned, scheduler.Lane("invoice-42"))
+	}
+	assert.Less(t, pinned, uint64(4))
+}
+
+func TestLaneScheduler_NonceKey(t *testing.T) {
+	sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+
+	scheduler, err := NewLaneScheduler(2)
+	require.NoError(t, err)
+
+	// lane 0 is the nonce key used without lanes
+	assert.Equal(t, computeKey(sender), scheduler.NonceKey(sender, ""))
+
+	// the lane is set above the bits of the default key
+	expected := new(big.Int).Lsh(big.NewInt(1), nonceLaneShift)
+	expected.Or(expected, computeKey(sender))
+	assert.Equal(t, expected, scheduler.NonceKey(sender, ""))
+}
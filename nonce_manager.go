@@ -0,0 +1,162 @@
+package zerodev
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"sort"
+	"sync"
+)
+
+// nonceSequenceBits is the size of the sequence in the low bits of an EntryPoint nonce, the key is in the 192 high bits
+const nonceSequenceBits = 64
+
+// NonceManager reserves the nonces of user operations prepared concurrently for the same sender.
+// The nonce of a sender and key is read from the EntryPoint once and then handed out locally, so parallel sends get
+// consecutive nonces instead of the same one.
+type NonceManager struct {
+	EntryPoint Entrypoint
+
+	mu     sync.Mutex
+	states map[nonceManagerKey]*nonceState
+}
+
+// nonceManagerKey is the sender and the 192 bit nonce key
+type nonceManagerKey struct {
+	Sender common.Address
+	Key    [24]byte
+}
+
+type nonceState struct {
+	// next is the nonce handed out when no released nonce is left
+	next *big.Int
+	// released are reserved nonces below next whose user operations were never sent, lowest first
+	released []*big.Int
+}
+
+func NewNonceManager(entrypoint Entrypoint) (*NonceManager, error) {
+	if entrypoint == nil {
+		return nil, errors.New("entrypoint is required")
+	}
+
+	return &NonceManager{
+		EntryPoint: entrypoint,
+		states:     make(map[nonceManagerKey]*nonceState),
+	}, nil
+}
+
+// Reserve returns the next free nonce of the sender for the 192 bit nonce key.
+// Nonces released before are handed out again first, so no gap is left in front of the reserved ones.
+func (m *NonceManager) Reserve(ctx context.Context, sender common.Address, key *big.Int) (*big.Int, error) {
+	if key == nil {
+		key = big.NewInt(0)
+	}
+
+	stateKey, err := newNonceManagerKey(sender, key)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.states[stateKey]
+	if !ok {
+		// the EntryPoint is read without holding the lock, reservations of other senders are not blocked by it
+		m.mu.Unlock()
+		onChain, err := m.EntryPoint.GetNonceWithKeyContext(ctx, sender, key)
+		m.mu.Lock()
+		if err != nil {
+			return nil, err
+		}
+
+		// another reservation may have read the nonce meanwhile, the first one wins
+		if state, ok = m.states[stateKey]; !ok {
+			state = &nonceState{next: onChain}
+			m.states[stateKey] = state
+		}
+	}
+
+	if len(state.released) > 0 {
+		nonce := state.released[0]
+		state.released = state.released[1:]
+		return nonce, nil
+	}
+
+	nonce := new(big.Int).Set(state.next)
+	state.next.Add(state.next, big.NewInt(1))
+	return nonce, nil
+}
+
+// Release returns the reserved nonce of a user operation which was never sent, it is handed out again by the next Reserve.
+// Nonces which were not reserved are ignored.
+func (m *NonceManager) Release(sender common.Address, nonce *big.Int) {
+	if nonce == nil {
+		return
+	}
+
+	stateKey, err := newNonceManagerKey(sender, nonceKey(nonce))
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.states[stateKey]
+	if !ok || nonce.Cmp(state.next) >= 0 {
+		return
+	}
+
+	for _, released := range state.released {
+		if released.Cmp(nonce) == 0 {
+			return
+		}
+	}
+
+	state.released = append(state.released, new(big.Int).Set(nonce))
+	sort.Slice(state.released, func(i, j int) bool {
+		return state.released[i].Cmp(state.released[j]) < 0
+	})
+
+	// the highest nonces are not in front of any reserved one, they are dropped instead of kept as released
+	last := new(big.Int).Sub(state.next, big.NewInt(1))
+	for len(state.released) > 0 && state.released[len(state.released)-1].Cmp(last) == 0 {
+		state.released = state.released[:len(state.released)-1]
+		state.next = last
+		last = new(big.Int).Sub(last, big.NewInt(1))
+	}
+}
+
+// Reset forgets the nonces of the sender for the 192 bit nonce key, the next Reserve reads the nonce from the EntryPoint again.
+// Used to reconcile with the chain after the EntryPoint rejected a nonce (AA25), e.g. when another client used it.
+func (m *NonceManager) Reset(sender common.Address, key *big.Int) {
+	stateKey, err := newNonceManagerKey(sender, key)
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.states, stateKey)
+}
+
+func newNonceManagerKey(sender common.Address, key *big.Int) (nonceManagerKey, error) {
+	stateKey := nonceManagerKey{Sender: sender}
+	if key == nil {
+		return stateKey, nil
+	}
+	if key.Sign() < 0 || key.BitLen() > 192 {
+		return stateKey, errors.New("nonce key must be a 192 bit unsigned integer")
+	}
+
+	key.FillBytes(stateKey.Key[:])
+	return stateKey, nil
+}
+
+// nonceKey returns the 192 bit key of the EntryPoint nonce
+func nonceKey(nonce *big.Int) *big.Int {
+	return new(big.Int).Rsh(nonce, nonceSequenceBits)
+}
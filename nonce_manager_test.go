@@ -0,0 +1,125 @@
+package zerodev
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNonceManager returns a NonceManager reading the nonce from onChain and counting the EntryPoint reads
+func newTestNonceManager(t *testing.T, onChain func() *big.Int, reads *atomic.Int64) *NonceManager {
+	entrypoint, err := NewEntrypoint07(&mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			reads.Add(1)
+			*result.(*hexutil.Bytes) = common.LeftPadBytes(onChain().Bytes(), 32)
+			return nil
+		},
+	}, big.NewInt(ChainPolygonAmoy))
+	require.NoError(t, err)
+
+	nonceManager, err := NewNonceManager(entrypoint)
+	require.NoError(t, err)
+	return nonceManager
+}
+
+func TestNonceManager_Reserve(t *testing.T) {
+	sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+
+	var reads atomic.Int64
+	nonceManager := newTestNonceManager(t, func() *big.Int { return big.NewInt(5) }, &reads)
+
+	var mu sync.Mutex
+	reserved := make(map[int64]bool)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, err := nonceManager.Reserve(context.Background(), sender, big.NewInt(0))
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			reserved[nonce.Int64()] = true
+		}()
+	}
+	wg.Wait()
+
+	for nonce := int64(5); nonce < 15; nonce++ {
+		assert.True(t, reserved[nonce], "nonce %d not reserved", nonce)
+	}
+	assert.LessOrEqual(t, reads.Load(), int64(10))
+
+	// a different key has its own nonces
+	otherKey, err := nonceManager.Reserve(context.Background(), sender, big.NewInt(1))
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(5), otherKey)
+}
+
+func TestNonceManager_Release(t *testing.T) {
+	sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+	key := big.NewInt(7)
+	nonceAt := func(sequence int64) *big.Int {
+		return new(big.Int).Add(new(big.Int).Lsh(key, nonceSequenceBits), big.NewInt(sequence))
+	}
+
+	var reads atomic.Int64
+	nonceManager := newTestNonceManager(t, func() *big.Int { return nonceAt(0) }, &reads)
+
+	reserve := func() *big.Int {
+		nonce, err := nonceManager.Reserve(context.Background(), sender, key)
+		require.NoError(t, err)
+		return nonce
+	}
+
+	assert.Equal(t, nonceAt(0), reserve())
+	assert.Equal(t, nonceAt(1), reserve())
+	assert.Equal(t, nonceAt(2), reserve())
+
+	// a released nonce in front of reserved ones is handed out again first
+	nonceManager.Release(sender, nonceAt(1))
+	nonceManager.Release(sender, nonceAt(1))
+	assert.Equal(t, nonceAt(1), reserve())
+	assert.Equal(t, nonceAt(3), reserve())
+
+	// releasing the highest nonces lowers the next one
+	nonceManager.Release(sender, nonceAt(2))
+	nonceManager.Release(sender, nonceAt(3))
+	assert.Equal(t, nonceAt(2), reserve())
+	assert.Equal(t, nonceAt(3), reserve())
+
+	// nonces which were never reserved are ignored
+	nonceManager.Release(sender, nonceAt(10))
+	nonceManager.Release(common.HexToAddress("0x01"), nonceAt(0))
+	assert.Equal(t, nonceAt(4), reserve())
+
+	assert.Equal(t, int64(1), reads.Load())
+}
+
+func TestNonceManager_Reset(t *testing.T) {
+	sender := common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A")
+
+	var onChain, reads atomic.Int64
+	nonceManager := newTestNonceManager(t, func() *big.Int { return big.NewInt(onChain.Load()) }, &reads)
+
+	nonce, err := nonceManager.Reserve(context.Background(), sender, nil)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(0), nonce)
+
+	// another client used nonces meanwhile
+	onChain.Store(3)
+	nonceManager.Reset(sender, nil)
+
+	nonce, err = nonceManager.Reserve(context.Background(), sender, nil)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(3), nonce)
+	assert.Equal(t, int64(2), reads.Load())
+}
@@ -14,8 +14,54 @@ type SponsorUserOperationRequest struct {
 	ChainID           *big.Int       `json:"chainId"`
 	Operation         *UserOperation `json:"userOp"`
 	EntryPointAddress common.Address `json:"entryPointAddress"`
+	GasTokenData      *GasTokenData  `json:"gasTokenData,omitempty"`
 	ShouldOverrideFee bool           `json:"shouldOverrideFee"`
 	ShouldConsume     bool           `json:"shouldConsume"`
+	// SponsorshipPolicyID and WebhookData are set from SponsorshipOptions
+	SponsorshipPolicyID string                 `json:"sponsorshipPolicyId,omitempty"`
+	WebhookData         map[string]interface{} `json:"webhookData,omitempty"`
+}
+
+// SponsorshipOptions selects the gas policy and parameters of a sponsorship, nil options use the defaults
+type SponsorshipOptions struct {
+	// PolicyID selects the gas policy the sponsorship draws from
+	PolicyID string
+	// WebhookData is forwarded to the sponsorship webhook of the policy
+	WebhookData map[string]interface{}
+	// Context is merged into the ERC-7677 paymaster context
+	Context map[string]interface{}
+	// ShouldOverrideFee lets the paymaster override the gas fees of the user operation
+	ShouldOverrideFee bool
+	// ShouldConsume counts the sponsorship against the policy limits, true when nil
+	ShouldConsume *bool
+	// GasLimits overrides and scales the estimated gas limits before the paymaster signs them
+	GasLimits *GasLimitOptions
+}
+
+func (o *SponsorshipOptions) shouldConsume() bool {
+	return o == nil || o.ShouldConsume == nil || *o.ShouldConsume
+}
+
+// GasTokenData selects the ERC-20 token the sender pays the paymaster with
+type GasTokenData struct {
+	TokenAddress common.Address `json:"tokenAddress"`
+}
+
+type GetERC20TokenQuotesRequest struct {
+	ChainID           *big.Int       `json:"chainId"`
+	Operation         *UserOperation `json:"userOp"`
+	EntryPointAddress common.Address `json:"entryPointAddress"`
+	TokenAddress      common.Address `json:"tokenAddress"`
+}
+
+// ERC20TokenQuote is the cost of the user operation in the gas token
+type ERC20TokenQuote struct {
+	// Paymaster is the token paymaster which has to be approved to transfer MaxGasCostToken
+	Paymaster       common.Address `json:"paymaster"`
+	MaxGasCostToken *hexutil.Big   `json:"maxGasCostToken"`
+	TokenDecimals   hexutil.Uint64 `json:"tokenDecimals"`
+	// ExchangeRate is the amount of the token per 1 ether of gas cost, in the token's smallest unit
+	ExchangeRate *hexutil.Big `json:"exchangeRate,omitempty"`
 }
 
 type SponsorUserOperationResponse struct {
@@ -80,6 +126,33 @@ func (r *SponsorUserOperationResponse) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// Paymaster sponsors user operations, it sets the paymaster fields and the gas limits of the user operation
+type Paymaster interface {
+	SponsorUserOperation(op *UserOperation) (*SponsorUserOperationResponse, error)
+	SponsorUserOperationContext(ctx context.Context, op *UserOperation) (*SponsorUserOperationResponse, error)
+	SponsorUserOperationWithOptions(op *UserOperation, options *SponsorshipOptions) (*SponsorUserOperationResponse, error)
+	SponsorUserOperationWithOptionsContext(ctx context.Context, op *UserOperation, options *SponsorshipOptions) (*SponsorUserOperationResponse, error)
+}
+
+// TokenPaymaster is a Paymaster letting the sender pay for gas in ERC-20 tokens
+type TokenPaymaster interface {
+	Paymaster
+	GetERC20TokenQuoteContext(ctx context.Context, op *UserOperation, token common.Address) (*ERC20TokenQuote, error)
+	SponsorUserOperationWithGasTokenContext(ctx context.Context, op *UserOperation, token common.Address) (*SponsorUserOperationResponse, error)
+	SponsorUserOperationWithGasTokenWithOptionsContext(ctx context.Context, op *UserOperation, token common.Address, options *SponsorshipOptions) (*SponsorUserOperationResponse, error)
+}
+
+// PaymasterType selects the paymaster protocol spoken by the paymaster RPC
+type PaymasterType string
+
+const (
+	// PaymasterTypeZeroDev uses ZeroDev's zd_sponsorUserOperation, the default
+	PaymasterTypeZeroDev PaymasterType = "zerodev"
+	// PaymasterTypeERC7677 uses the standard pm_getPaymasterStubData and pm_getPaymasterData
+	PaymasterTypeERC7677 PaymasterType = "erc7677"
+)
+
+// PaymasterClient sponsors user operations with ZeroDev's zd_sponsorUserOperation
 type PaymasterClient struct {
 	Client     types.RPCClient
 	EntryPoint Entrypoint
@@ -107,21 +180,146 @@ func (p *PaymasterClient) GetChainID() *big.Int {
 }
 
 func (p *PaymasterClient) SponsorUserOperation(op *UserOperation) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationContext(context.Background(), op)
+}
+
+func (p *PaymasterClient) SponsorUserOperationContext(ctx context.Context, op *UserOperation) (*SponsorUserOperationResponse, error) {
+	return p.sponsorUserOperation(ctx, op, nil, nil)
+}
+
+// SponsorUserOperationWithOptions sponsors the user operation with the gas policy and parameters of the options
+func (p *PaymasterClient) SponsorUserOperationWithOptions(op *UserOperation, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationWithOptionsContext(context.Background(), op, options)
+}
+
+func (p *PaymasterClient) SponsorUserOperationWithOptionsContext(ctx context.Context, op *UserOperation, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	return p.sponsorUserOperation(ctx, op, nil, options)
+}
+
+// SponsorUserOperationWithGasToken sponsors the user operation in exchange for the ERC-20 token paid by the sender.
+// The sender has to approve the token paymaster, see GetERC20TokenQuote.
+func (p *PaymasterClient) SponsorUserOperationWithGasToken(op *UserOperation, token common.Address) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationWithGasTokenContext(context.Background(), op, token)
+}
+
+func (p *PaymasterClient) SponsorUserOperationWithGasTokenContext(ctx context.Context, op *UserOperation, token common.Address) (*SponsorUserOperationResponse, error) {
+	return p.sponsorUserOperation(ctx, op, &GasTokenData{TokenAddress: token}, nil)
+}
+
+// SponsorUserOperationWithGasTokenWithOptions is SponsorUserOperationWithGasToken with the gas policy and parameters of the options
+func (p *PaymasterClient) SponsorUserOperationWithGasTokenWithOptions(op *UserOperation, token common.Address, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationWithGasTokenWithOptionsContext(context.Background(), op, token, options)
+}
+
+func (p *PaymasterClient) SponsorUserOperationWithGasTokenWithOptionsContext(ctx context.Context, op *UserOperation, token common.Address, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	return p.sponsorUserOperation(ctx, op, &GasTokenData{TokenAddress: token}, options)
+}
+
+func (p *PaymasterClient) sponsorUserOperation(ctx context.Context, op *UserOperation, gasTokenData *GasTokenData, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
 	op.Signature = common.FromHex(SignatureDummy)
 
+	// the paymaster estimates and signs the gas limits at once, adjusted limits are sponsored with a second request,
+	// so the first one only estimates them without consuming the policy
+	adjustGasLimits := options != nil && !options.GasLimits.empty()
+
 	var request = SponsorUserOperationRequest{
 		ChainID:           p.ChainID,
 		EntryPointAddress: p.EntryPoint.GetAddress(),
 		Operation:         op,
+		GasTokenData:      gasTokenData,
 		ShouldOverrideFee: false,
-		ShouldConsume:     true,
+		ShouldConsume:     options.shouldConsume() && !adjustGasLimits,
+	}
+
+	if options != nil {
+		request.ShouldOverrideFee = options.ShouldOverrideFee
+		request.SponsorshipPolicyID = options.PolicyID
+		request.WebhookData = options.WebhookData
 	}
 
 	var response SponsorUserOperationResponse
 
-	err := p.Client.CallContext(context.Background(), &response, "zd_sponsorUserOperation", request)
+	err := p.Client.CallContext(ctx, &response, "zd_sponsorUserOperation", request)
+	if err != nil {
+		return nil, newRPCError("zd_sponsorUserOperation", err)
+	}
+
+	if !adjustGasLimits {
+		return &response, nil
+	}
+
+	adjustedOp := *op
+	setSponsorship(&adjustedOp, &response)
+	if !options.GasLimits.apply(&adjustedOp) && !options.shouldConsume() {
+		return &response, nil
+	}
+
+	adjustedOp.Paymaster = nil
+	adjustedOp.PaymasterData = nil
+	request.Operation = &adjustedOp
+	request.ShouldConsume = options.shouldConsume()
+
+	response = SponsorUserOperationResponse{}
+	err = p.Client.CallContext(ctx, &response, "zd_sponsorUserOperation", request)
+	if err != nil {
+		return nil, newRPCError("zd_sponsorUserOperation", err)
+	}
+
+	if err := checkSponsoredGasLimits(&adjustedOp, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// checkSponsoredGasLimits fails when the paymaster signed other gas limits than the adjusted ones it was asked to sponsor
+func checkSponsoredGasLimits(adjustedOp *UserOperation, response *SponsorUserOperationResponse) error {
+	for _, limit := range []struct {
+		name      string
+		adjusted  *big.Int
+		sponsored *big.Int
+	}{
+		{"callGasLimit", adjustedOp.CallGasLimit, response.CallGasLimit},
+		{"verificationGasLimit", adjustedOp.VerificationGasLimit, response.VerificationGasLimit},
+		{"preVerificationGas", adjustedOp.PreVerificationGas, response.PreVerificationGas},
+		{"paymasterVerificationGasLimit", adjustedOp.PaymasterVerificationGasLimit, response.PaymasterVerificationGasLimit},
+		{"paymasterPostOpGasLimit", adjustedOp.PaymasterPostOpGasLimit, response.PaymasterPostOpGasLimit},
+	} {
+		if limit.adjusted == nil || (limit.sponsored != nil && limit.adjusted.Cmp(limit.sponsored) == 0) {
+			continue
+		}
+		return errors.Wrapf(ErrSponsoredGasLimitsMismatch, "%s %s sponsored as %s", limit.name, limit.adjusted, limit.sponsored)
+	}
+
+	return nil
+}
+
+// GetERC20TokenQuote returns the maximal cost of the sponsored user operation in the token
+func (p *PaymasterClient) GetERC20TokenQuote(op *UserOperation, token common.Address) (*ERC20TokenQuote, error) {
+	return p.GetERC20TokenQuoteContext(context.Background(), op, token)
+}
+
+func (p *PaymasterClient) GetERC20TokenQuoteContext(ctx context.Context, op *UserOperation, token common.Address) (*ERC20TokenQuote, error) {
+	var request = GetERC20TokenQuotesRequest{
+		ChainID:           p.ChainID,
+		EntryPointAddress: p.EntryPoint.GetAddress(),
+		Operation:         op,
+		TokenAddress:      token,
+	}
+
+	var response ERC20TokenQuote
+
+	err := p.Client.CallContext(ctx, &response, "stackup_getERC20TokenQuotes", request)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to call zd_sponsorUserOperation")
+		return nil, newRPCError("stackup_getERC20TokenQuotes", err)
+	}
+
+	if response.MaxGasCostToken == nil {
+		return nil, errors.New("token quote without maxGasCostToken")
+	}
+
+	if response.Paymaster == (common.Address{}) {
+		response.Paymaster = common.HexToAddress(AddressERC20Paymaster07)
 	}
 
 	return &response, nil
@@ -0,0 +1,139 @@
+package zerodev
+
+import (
+	"bytes"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"time"
+)
+
+// PaymasterDataLayout is the encoding of the paymaster data
+type PaymasterDataLayout string
+
+const (
+	// PaymasterDataLayoutModeByte mode byte, validUntil and validAfter as uint48, mode specific fields and the signature,
+	// used by the ZeroDev and Pimlico singleton paymasters
+	PaymasterDataLayoutModeByte PaymasterDataLayout = "mode_byte"
+	// PaymasterDataLayoutVerifyingPaymaster abi.encode(validUntil, validAfter) and the signature,
+	// used by the eth-infinitism VerifyingPaymaster, see VerifyingPaymaster
+	PaymasterDataLayoutVerifyingPaymaster PaymasterDataLayout = "verifying_paymaster"
+)
+
+// PaymasterMode is the mode of paymaster data in the mode byte layout
+type PaymasterMode uint8
+
+const (
+	PaymasterModeVerifying PaymasterMode = 0
+	PaymasterModeERC20     PaymasterMode = 1
+)
+
+const (
+	uint48Length = 6
+	// erc20ModeFieldsLength is the length of the ERC-20 mode fields between validAfter and the signature
+	// without the optional ones: token, postOpGas, exchangeRate, paymasterValidationGasLimit and treasury
+	erc20ModeFieldsLength = common.AddressLength + 16 + 32 + 16 + common.AddressLength
+)
+
+// DecodedPaymasterData is the paymaster data of a sponsored user operation
+type DecodedPaymasterData struct {
+	Layout PaymasterDataLayout
+	// Mode and AllowAllBundlers are only set in the mode byte layout
+	Mode             PaymasterMode
+	AllowAllBundlers bool
+	// ValidUntil is a unix timestamp, zero means the sponsorship does not expire
+	ValidUntil uint64
+	ValidAfter uint64
+	// Token is the gas token of the ERC-20 mode
+	Token     *common.Address
+	Signature []byte
+}
+
+// DecodePaymasterData decodes paymaster data of the known layouts, fails on data of other paymasters
+func DecodePaymasterData(data []byte) (*DecodedPaymasterData, error) {
+	if decoded, ok := decodeVerifyingPaymasterData(data); ok {
+		return decoded, nil
+	}
+
+	if decoded, ok := decodeModeBytePaymasterData(data); ok {
+		return decoded, nil
+	}
+
+	return nil, errors.New("unknown paymaster data layout")
+}
+
+// decodeVerifyingPaymasterData decodes abi.encode(uint48 validUntil, uint48 validAfter) followed by a 64 or 65 bytes signature
+func decodeVerifyingPaymasterData(data []byte) (*DecodedPaymasterData, bool) {
+	if len(data) != 64+64 && len(data) != 64+65 {
+		return nil, false
+	}
+
+	// the words of uint48 values are zero padded
+	padding := make([]byte, 32-uint48Length)
+	if !bytes.Equal(data[:len(padding)], padding) || !bytes.Equal(data[32:32+len(padding)], padding) {
+		return nil, false
+	}
+
+	return &DecodedPaymasterData{
+		Layout:     PaymasterDataLayoutVerifyingPaymaster,
+		ValidUntil: new(big.Int).SetBytes(data[:32]).Uint64(),
+		ValidAfter: new(big.Int).SetBytes(data[32:64]).Uint64(),
+		Signature:  data[64:],
+	}, true
+}
+
+// decodeModeBytePaymasterData decodes the mode byte layout, (mode << 1) | allowAllBundlers, followed by:
+// verifying mode: validUntil, validAfter and the signature;
+// ERC-20 mode: a flags byte, validUntil, validAfter, the ERC-20 fields and the signature
+func decodeModeBytePaymasterData(data []byte) (*DecodedPaymasterData, bool) {
+	if len(data) < 1 {
+		return nil, false
+	}
+
+	decoded := &DecodedPaymasterData{
+		Layout:           PaymasterDataLayoutModeByte,
+		Mode:             PaymasterMode(data[0] >> 1),
+		AllowAllBundlers: data[0]&1 == 1,
+	}
+
+	var fields []byte
+	switch decoded.Mode {
+	case PaymasterModeVerifying:
+		fields = data[1:]
+		if len(fields) != 2*uint48Length+64 && len(fields) != 2*uint48Length+65 {
+			return nil, false
+		}
+	case PaymasterModeERC20:
+		if len(data) < 2+2*uint48Length+erc20ModeFieldsLength+64 {
+			return nil, false
+		}
+		fields = data[2:]
+	default:
+		return nil, false
+	}
+
+	decoded.ValidUntil = new(big.Int).SetBytes(fields[:uint48Length]).Uint64()
+	decoded.ValidAfter = new(big.Int).SetBytes(fields[uint48Length : 2*uint48Length]).Uint64()
+
+	if decoded.Mode == PaymasterModeERC20 {
+		token := common.BytesToAddress(fields[2*uint48Length : 2*uint48Length+common.AddressLength])
+		decoded.Token = &token
+	}
+
+	// the signature closes the paymaster data, 64 bytes compact or 65 bytes
+	signatureLength := 65
+	if decoded.Mode == PaymasterModeVerifying && len(fields) == 2*uint48Length+64 {
+		signatureLength = 64
+	}
+	decoded.Signature = fields[len(fields)-signatureLength:]
+
+	return decoded, true
+}
+
+// ExpiresWithin reports whether the sponsorship is no longer valid at now plus margin
+func (d *DecodedPaymasterData) ExpiresWithin(now time.Time, margin time.Duration) bool {
+	if d.ValidUntil == 0 {
+		return false
+	}
+	return uint64(now.Add(margin).Unix()) >= d.ValidUntil
+}
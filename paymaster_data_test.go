@@ -0,0 +1,92 @@
+package zerodev
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodePaymasterData(t *testing.T) {
+	signature := bytes.Repeat([]byte{0xab}, 65)
+	token := common.HexToAddress("0xE261D618a959aFfFd53168Cd07D12E37B26761db")
+
+	verifyingPaymasterData, err := EncodeVerifyingPaymasterData(1_700_000_000, 1_600_000_000, signature)
+	require.NoError(t, err)
+
+	modeByteVerifying := append(append([]byte{0x01}, common.FromHex("0x00006553f100000000000000")...), signature...)
+
+	modeByteERC20 := append([]byte{0x02, 0x00}, common.FromHex("0x00006553f100000000000000")...)
+	modeByteERC20 = append(modeByteERC20, token.Bytes()...)
+	modeByteERC20 = append(modeByteERC20, make([]byte, erc20ModeFieldsLength-common.AddressLength)...)
+	modeByteERC20 = append(modeByteERC20, signature...)
+
+	tests := []struct {
+		name          string
+		data          []byte
+		expected      *DecodedPaymasterData
+		expectedError bool
+	}{
+		{
+			name: "verifying_paymaster",
+			data: verifyingPaymasterData,
+			expected: &DecodedPaymasterData{
+				Layout:     PaymasterDataLayoutVerifyingPaymaster,
+				ValidUntil: 1_700_000_000,
+				ValidAfter: 1_600_000_000,
+				Signature:  signature,
+			},
+		},
+		{
+			name: "mode_byte_verifying",
+			data: modeByteVerifying,
+			expected: &DecodedPaymasterData{
+				Layout:           PaymasterDataLayoutModeByte,
+				Mode:             PaymasterModeVerifying,
+				AllowAllBundlers: true,
+				ValidUntil:       1_700_000_000,
+				Signature:        signature,
+			},
+		},
+		{
+			name: "mode_byte_erc20",
+			data: modeByteERC20,
+			expected: &DecodedPaymasterData{
+				Layout:     PaymasterDataLayoutModeByte,
+				Mode:       PaymasterModeERC20,
+				ValidUntil: 1_700_000_000,
+				Token:      &token,
+				Signature:  signature,
+			},
+		},
+		{
+			name:          "unknown_layout",
+			data:          common.FromHex("0xdeadbeef"),
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodePaymasterData(tt.data)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, decoded)
+		})
+	}
+}
+
+func TestDecodedPaymasterData_ExpiresWithin(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	assert.False(t, (&DecodedPaymasterData{}).ExpiresWithin(now, time.Hour))
+	assert.False(t, (&DecodedPaymasterData{ValidUntil: 1_700_000_100}).ExpiresWithin(now, time.Minute))
+	assert.True(t, (&DecodedPaymasterData{ValidUntil: 1_700_000_100}).ExpiresWithin(now, 2*time.Minute))
+}
@@ -0,0 +1,209 @@
+package zerodev
+
+import (
+	"context"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/friendsofgo/errors"
+	"math/big"
+)
+
+// PaymasterSponsor identifies the sponsor returned by pm_getPaymasterStubData
+type PaymasterSponsor struct {
+	Name string `json:"name"`
+	Icon string `json:"icon,omitempty"`
+}
+
+type GetPaymasterStubDataResponse struct {
+	Sponsor                       *PaymasterSponsor `json:"sponsor,omitempty"`
+	Paymaster                     hexutil.Bytes     `json:"paymaster"`
+	PaymasterData                 hexutil.Bytes     `json:"paymasterData"`
+	PaymasterVerificationGasLimit *hexutil.Big      `json:"paymasterVerificationGasLimit"`
+	PaymasterPostOpGasLimit       *hexutil.Big      `json:"paymasterPostOpGasLimit"`
+	// IsFinal is true when the stub data is also the final paymaster data and pm_getPaymasterData is not needed
+	IsFinal bool `json:"isFinal"`
+}
+
+type GetPaymasterDataResponse struct {
+	Paymaster     hexutil.Bytes `json:"paymaster"`
+	PaymasterData hexutil.Bytes `json:"paymasterData"`
+}
+
+// ERC7677PaymasterClient sponsors user operations using the ERC-7677 paymaster web service capability:
+// pm_getPaymasterStubData provides paymaster data for gas estimation by the bundler,
+// pm_getPaymasterData provides the final paymaster data once the gas limits are known.
+type ERC7677PaymasterClient struct {
+	Client     types.RPCClient
+	Bundler    *BundlerClient
+	EntryPoint Entrypoint
+	ChainID    *big.Int
+	// Context is passed to the paymaster as is, e.g. a sponsorship policy id
+	Context map[string]interface{}
+}
+
+func NewERC7677PaymasterClient(rpcClient types.RPCClient, bundler *BundlerClient, entrypoint Entrypoint, chainID *big.Int, paymasterContext map[string]interface{}) (*ERC7677PaymasterClient, error) {
+	if bundler == nil || entrypoint == nil || chainID == nil {
+		return nil, errors.New("bundler, entrypoint, and chainID are required")
+	}
+
+	return &ERC7677PaymasterClient{
+		Client:     rpcClient,
+		Bundler:    bundler,
+		EntryPoint: entrypoint,
+		ChainID:    chainID,
+		Context:    paymasterContext,
+	}, nil
+}
+
+func (p *ERC7677PaymasterClient) GetEntryPoint() Entrypoint {
+	return p.EntryPoint
+}
+
+func (p *ERC7677PaymasterClient) GetChainID() *big.Int {
+	return p.ChainID
+}
+
+func (p *ERC7677PaymasterClient) GetPaymasterStubData(op *UserOperation) (*GetPaymasterStubDataResponse, error) {
+	return p.GetPaymasterStubDataContext(context.Background(), op)
+}
+
+func (p *ERC7677PaymasterClient) GetPaymasterStubDataContext(ctx context.Context, op *UserOperation) (*GetPaymasterStubDataResponse, error) {
+	return p.GetPaymasterStubDataWithOptionsContext(ctx, op, nil)
+}
+
+// GetPaymasterStubDataWithOptions is GetPaymasterStubData with the sponsorship options merged into the paymaster context
+func (p *ERC7677PaymasterClient) GetPaymasterStubDataWithOptions(op *UserOperation, options *SponsorshipOptions) (*GetPaymasterStubDataResponse, error) {
+	return p.GetPaymasterStubDataWithOptionsContext(context.Background(), op, options)
+}
+
+func (p *ERC7677PaymasterClient) GetPaymasterStubDataWithOptionsContext(ctx context.Context, op *UserOperation, options *SponsorshipOptions) (*GetPaymasterStubDataResponse, error) {
+	var response GetPaymasterStubDataResponse
+
+	err := p.Client.CallContext(ctx, &response, "pm_getPaymasterStubData", op, p.EntryPoint.GetAddress(), hexutil.EncodeBig(p.ChainID), p.context(options))
+	if err != nil {
+		return nil, newRPCError("pm_getPaymasterStubData", err)
+	}
+
+	return &response, nil
+}
+
+func (p *ERC7677PaymasterClient) GetPaymasterData(op *UserOperation) (*GetPaymasterDataResponse, error) {
+	return p.GetPaymasterDataContext(context.Background(), op)
+}
+
+func (p *ERC7677PaymasterClient) GetPaymasterDataContext(ctx context.Context, op *UserOperation) (*GetPaymasterDataResponse, error) {
+	return p.GetPaymasterDataWithOptionsContext(ctx, op, nil)
+}
+
+// GetPaymasterDataWithOptions is GetPaymasterData with the sponsorship options merged into the paymaster context
+func (p *ERC7677PaymasterClient) GetPaymasterDataWithOptions(op *UserOperation, options *SponsorshipOptions) (*GetPaymasterDataResponse, error) {
+	return p.GetPaymasterDataWithOptionsContext(context.Background(), op, options)
+}
+
+func (p *ERC7677PaymasterClient) GetPaymasterDataWithOptionsContext(ctx context.Context, op *UserOperation, options *SponsorshipOptions) (*GetPaymasterDataResponse, error) {
+	var response GetPaymasterDataResponse
+
+	err := p.Client.CallContext(ctx, &response, "pm_getPaymasterData", op, p.EntryPoint.GetAddress(), hexutil.EncodeBig(p.ChainID), p.context(options))
+	if err != nil {
+		return nil, newRPCError("pm_getPaymasterData", err)
+	}
+
+	return &response, nil
+}
+
+func (p *ERC7677PaymasterClient) SponsorUserOperation(op *UserOperation) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationContext(context.Background(), op)
+}
+
+// SponsorUserOperationContext gets the stub paymaster data, estimates the gas limits with the bundler
+// and then gets the final paymaster data for the estimated user operation.
+func (p *ERC7677PaymasterClient) SponsorUserOperationContext(ctx context.Context, op *UserOperation) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationWithOptionsContext(ctx, op, nil)
+}
+
+// SponsorUserOperationWithOptions sponsors the user operation with the policy id, webhook data and context of the options
+// added to the paymaster context, the other options are not supported by ERC-7677
+func (p *ERC7677PaymasterClient) SponsorUserOperationWithOptions(op *UserOperation, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationWithOptionsContext(context.Background(), op, options)
+}
+
+func (p *ERC7677PaymasterClient) SponsorUserOperationWithOptionsContext(ctx context.Context, op *UserOperation, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	op.Signature = common.FromHex(SignatureDummy)
+
+	stub, err := p.GetPaymasterStubDataWithOptionsContext(ctx, op, options)
+	if err != nil {
+		return nil, err
+	}
+
+	sponsoredOp := *op
+	sponsoredOp.Paymaster = stub.Paymaster
+	sponsoredOp.PaymasterData = stub.PaymasterData
+	sponsoredOp.PaymasterVerificationGasLimit = stub.PaymasterVerificationGasLimit.ToInt()
+	sponsoredOp.PaymasterPostOpGasLimit = stub.PaymasterPostOpGasLimit.ToInt()
+
+	gasEstimate, err := p.Bundler.EstimateUserOperationGasContext(ctx, &sponsoredOp)
+	if err != nil {
+		return nil, err
+	}
+
+	sponsoredOp.PreVerificationGas = gasEstimate.PreVerificationGas
+	sponsoredOp.VerificationGasLimit = gasEstimate.VerificationGasLimit
+	sponsoredOp.CallGasLimit = gasEstimate.CallGasLimit
+	// limits provided by the paymaster take precedence over the bundler's estimate
+	if sponsoredOp.PaymasterVerificationGasLimit == nil {
+		sponsoredOp.PaymasterVerificationGasLimit = gasEstimate.PaymasterVerificationGasLimit
+	}
+	if sponsoredOp.PaymasterPostOpGasLimit == nil {
+		sponsoredOp.PaymasterPostOpGasLimit = gasEstimate.PaymasterPostOpGasLimit
+	}
+	if options != nil {
+		options.GasLimits.apply(&sponsoredOp)
+	}
+
+	if !stub.IsFinal {
+		paymasterData, err := p.GetPaymasterDataWithOptionsContext(ctx, &sponsoredOp, options)
+		if err != nil {
+			return nil, err
+		}
+
+		sponsoredOp.Paymaster = paymasterData.Paymaster
+		sponsoredOp.PaymasterData = paymasterData.PaymasterData
+	}
+
+	return &SponsorUserOperationResponse{
+		CallGasLimit:                  sponsoredOp.CallGasLimit,
+		PaymasterVerificationGasLimit: sponsoredOp.PaymasterVerificationGasLimit,
+		PaymasterPostOpGasLimit:       sponsoredOp.PaymasterPostOpGasLimit,
+		VerificationGasLimit:          sponsoredOp.VerificationGasLimit,
+		MaxPriorityFeePerGas:          sponsoredOp.MaxPriorityFeePerGas,
+		Paymaster:                     sponsoredOp.Paymaster,
+		MaxFeePerGas:                  sponsoredOp.MaxFeePerGas,
+		PaymasterData:                 sponsoredOp.PaymasterData,
+		PreVerificationGas:            sponsoredOp.PreVerificationGas,
+	}, nil
+}
+
+// context returns the paymaster context with the sponsorship options merged into the configured one, ERC-7677 requires an object
+func (p *ERC7677PaymasterClient) context(options *SponsorshipOptions) map[string]interface{} {
+	paymasterContext := make(map[string]interface{}, len(p.Context))
+	for key, value := range p.Context {
+		paymasterContext[key] = value
+	}
+
+	if options == nil {
+		return paymasterContext
+	}
+
+	for key, value := range options.Context {
+		paymasterContext[key] = value
+	}
+	if options.PolicyID != "" {
+		paymasterContext["sponsorshipPolicyId"] = options.PolicyID
+	}
+	if options.WebhookData != nil {
+		paymasterContext["webhookData"] = options.WebhookData
+	}
+
+	return paymasterContext
+}
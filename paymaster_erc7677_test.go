@@ -0,0 +1,119 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestERC7677PaymasterClient_SponsorUserOperation(t *testing.T) {
+	tests := []struct {
+		name                  string
+		stubResponse          string
+		expectedMethods       []string
+		expectedPaymasterData []byte
+	}{
+		{
+			name:                  "stub_then_final_data",
+			stubResponse:          `{"paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`,
+			expectedMethods:       []string{"pm_getPaymasterStubData", "eth_estimateUserOperationGas", "pm_getPaymasterData"},
+			expectedPaymasterData: common.FromHex("0x02"),
+		},
+		{
+			name:                  "final_stub",
+			stubResponse:          `{"paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10","isFinal":true}`,
+			expectedMethods:       []string{"pm_getPaymasterStubData", "eth_estimateUserOperationGas"},
+			expectedPaymasterData: common.FromHex("0x01"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods []string
+			rpcClient := &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					methods = append(methods, method)
+
+					var response string
+					switch method {
+					case "pm_getPaymasterStubData":
+						require.Len(t, args, 4)
+						assert.Equal(t, "0x13882", args[2])
+						assert.Equal(t, map[string]interface{}{"policyId": "test"}, args[3])
+						response = tt.stubResponse
+					case "eth_estimateUserOperationGas":
+						op := args[0].(*UserOperation)
+						assert.Equal(t, common.FromHex("0x00000000000000000000000000000000000000aa"), op.Paymaster)
+						response = `{"preVerificationGas":"0xd3e3","verificationGasLimit":"0x1079b","callGasLimit":"0x3f7e","paymasterVerificationGasLimit":"0x2000","paymasterPostOpGasLimit":"0x20"}`
+					case "pm_getPaymasterData":
+						op := args[0].(*UserOperation)
+						assert.Equal(t, big.NewInt(0x3f7e), op.CallGasLimit)
+						response = `{"paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x02"}`
+					}
+					return json.Unmarshal([]byte(response), result)
+				},
+			}
+
+			bundlerClient := newTestBundlerClient(t, rpcClient)
+			paymasterClient, err := NewERC7677PaymasterClient(rpcClient, bundlerClient, bundlerClient.EntryPoint, bundlerClient.ChainID, map[string]interface{}{"policyId": "test"})
+			require.NoError(t, err)
+
+			op := &UserOperation{Sender: common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"), Nonce: big.NewInt(1), MaxFeePerGas: big.NewInt(100)}
+			response, err := paymasterClient.SponsorUserOperation(op)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedMethods, methods)
+			assert.Equal(t, tt.expectedPaymasterData, response.PaymasterData)
+			assert.Equal(t, big.NewInt(0x1079b), response.VerificationGasLimit)
+			assert.Equal(t, big.NewInt(0x1000), response.PaymasterVerificationGasLimit)
+			assert.Equal(t, big.NewInt(100), response.MaxFeePerGas)
+		})
+	}
+}
+
+func TestERC7677PaymasterClient_SponsorUserOperationWithOptions(t *testing.T) {
+	var contexts []interface{}
+	rpcClient := &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "pm_getPaymasterStubData":
+				contexts = append(contexts, args[3])
+				response = `{"paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x01","paymasterVerificationGasLimit":"0x1000","paymasterPostOpGasLimit":"0x10"}`
+			case "eth_estimateUserOperationGas":
+				response = `{"preVerificationGas":"0xd3e3","verificationGasLimit":"0x1079b","callGasLimit":"0x3f7e","paymasterVerificationGasLimit":"0x2000","paymasterPostOpGasLimit":"0x20"}`
+			case "pm_getPaymasterData":
+				contexts = append(contexts, args[3])
+				response = `{"paymaster":"0x00000000000000000000000000000000000000aa","paymasterData":"0x02"}`
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	}
+
+	bundlerClient := newTestBundlerClient(t, rpcClient)
+	paymasterContext := map[string]interface{}{"sponsorshipPolicyId": "sp_default", "token": "abc"}
+	paymasterClient, err := NewERC7677PaymasterClient(rpcClient, bundlerClient, bundlerClient.EntryPoint, bundlerClient.ChainID, paymasterContext)
+	require.NoError(t, err)
+
+	op := &UserOperation{Sender: common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"), Nonce: big.NewInt(1), MaxFeePerGas: big.NewInt(100)}
+	_, err = paymasterClient.SponsorUserOperationWithOptions(op, &SponsorshipOptions{
+		PolicyID:    "sp_feature",
+		WebhookData: map[string]interface{}{"feature": "vehicle"},
+		Context:     map[string]interface{}{"validForSeconds": 60},
+	})
+	require.NoError(t, err)
+
+	expectedContext := map[string]interface{}{
+		"sponsorshipPolicyId": "sp_feature",
+		"token":               "abc",
+		"validForSeconds":     60,
+		"webhookData":         map[string]interface{}{"feature": "vehicle"},
+	}
+	assert.Equal(t, []interface{}{expectedContext, expectedContext}, contexts)
+	assert.Equal(t, "sp_default", paymasterContext["sponsorshipPolicyId"])
+}
@@ -0,0 +1,250 @@
+package zerodev
+
+import (
+	"context"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"time"
+)
+
+var uint48, _ = abi.NewType("uint48", "", nil)
+
+// verifyingPaymasterStubSignature is a well-formed signature, the VerifyingPaymaster reverts on malformed ones during estimation
+var verifyingPaymasterStubSignature = common.FromHex(SignatureDummy)
+
+// VerifyingPaymasterConfig configures VerifyingPaymaster. Zero values are replaced with defaults.
+type VerifyingPaymasterConfig struct {
+	// Address of the deployed VerifyingPaymaster contract
+	Address common.Address
+	// ValidFor is how long the sponsorship is valid from signing, without expiry when zero
+	ValidFor time.Duration
+	// VerificationGasLimit and PostOpGasLimit override the paymaster gas limits estimated by the bundler
+	VerificationGasLimit *big.Int
+	PostOpGasLimit       *big.Int
+}
+
+// VerifyingPaymaster sponsors user operations with a VerifyingPaymaster contract (eth-infinitism, entrypoint 0.7)
+// by signing them with a local key, without any paymaster RPC.
+// Signer signs the EIP-191 hash of the paymaster hash with SignHash like an EOA, e.g. a PrivateKeySigner of the verifying signer key.
+type VerifyingPaymaster struct {
+	Bundler    *BundlerClient
+	EntryPoint Entrypoint
+	ChainID    *big.Int
+	Signer     types.AccountSigner
+	Config     VerifyingPaymasterConfig
+}
+
+func NewVerifyingPaymaster(bundler *BundlerClient, entrypoint Entrypoint, chainID *big.Int, signer types.AccountSigner, config VerifyingPaymasterConfig) (*VerifyingPaymaster, error) {
+	if bundler == nil || entrypoint == nil || chainID == nil || signer == nil {
+		return nil, errors.New("bundler, entrypoint, chainID and signer are required")
+	}
+
+	if config.Address == (common.Address{}) {
+		return nil, errors.New("verifying paymaster address is required")
+	}
+
+	return &VerifyingPaymaster{
+		Bundler:    bundler,
+		EntryPoint: entrypoint,
+		ChainID:    chainID,
+		Signer:     signer,
+		Config:     config,
+	}, nil
+}
+
+func (p *VerifyingPaymaster) GetEntryPoint() Entrypoint {
+	return p.EntryPoint
+}
+
+func (p *VerifyingPaymaster) GetChainID() *big.Int {
+	return p.ChainID
+}
+
+// GetHash computes the hash signed by the verifying signer, the same as VerifyingPaymaster.getHash.
+// The paymaster gas limits of the user operation are part of the hash, they have to be final.
+func (p *VerifyingPaymaster) GetHash(op *UserOperation, validUntil uint64, validAfter uint64) (common.Hash, error) {
+	args := abi.Arguments{
+		{Name: "sender", Type: address},
+		{Name: "nonce", Type: uint256},
+		{Name: "hashInitCode", Type: bytes32},
+		{Name: "hashCallData", Type: bytes32},
+		{Name: "accountGasLimits", Type: bytes32},
+		{Name: "paymasterGasLimits", Type: uint256},
+		{Name: "preVerificationGas", Type: uint256},
+		{Name: "gasFees", Type: bytes32},
+		{Name: "chainId", Type: uint256},
+		{Name: "paymaster", Type: address},
+		{Name: "validUntil", Type: uint48},
+		{Name: "validAfter", Type: uint48},
+	}
+
+	accountGasLimits := createPackedBuffer(
+		bigIntBytes(op.VerificationGasLimit),
+		bigIntBytes(op.CallGasLimit),
+	)
+
+	paymasterGasLimits := createPackedBuffer(
+		bigIntBytes(op.PaymasterVerificationGasLimit),
+		bigIntBytes(op.PaymasterPostOpGasLimit),
+	)
+
+	gasFees := createPackedBuffer(
+		bigIntBytes(op.MaxPriorityFeePerGas),
+		bigIntBytes(op.MaxFeePerGas),
+	)
+
+	preVerificationGas := op.PreVerificationGas
+	if preVerificationGas == nil {
+		preVerificationGas = big.NewInt(0)
+	}
+
+	packed, err := args.Pack(
+		op.Sender,
+		op.Nonce,
+		crypto.Keccak256Hash(common.FromHex("0x")),
+		crypto.Keccak256Hash(op.CallData),
+		toArray32(accountGasLimits),
+		new(big.Int).SetBytes(paymasterGasLimits.Bytes()),
+		preVerificationGas,
+		toArray32(gasFees),
+		p.ChainID,
+		p.Config.Address,
+		new(big.Int).SetUint64(validUntil),
+		new(big.Int).SetUint64(validAfter),
+	)
+	if err != nil {
+		return common.Hash{}, errors.Wrap(err, "failed to pack verifying paymaster hash")
+	}
+
+	return crypto.Keccak256Hash(packed), nil
+}
+
+// EncodeVerifyingPaymasterData encodes the paymaster data of the VerifyingPaymaster: abi.encode(validUntil, validAfter) followed by the signature
+func EncodeVerifyingPaymasterData(validUntil uint64, validAfter uint64, signature []byte) ([]byte, error) {
+	validity, err := abi.Arguments{{Type: uint48}, {Type: uint48}}.Pack(new(big.Int).SetUint64(validUntil), new(big.Int).SetUint64(validAfter))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to pack validity")
+	}
+
+	return append(validity, signature...), nil
+}
+
+// GetStubData sets the paymaster fields of the user operation with a stub signature, to be used for gas estimation
+func (p *VerifyingPaymaster) GetStubData(op *UserOperation) error {
+	paymasterData, err := EncodeVerifyingPaymasterData(0, 0, verifyingPaymasterStubSignature)
+	if err != nil {
+		return err
+	}
+
+	op.Paymaster = p.Config.Address.Bytes()
+	op.PaymasterData = paymasterData
+	op.PaymasterVerificationGasLimit = p.Config.VerificationGasLimit
+	op.PaymasterPostOpGasLimit = p.Config.PostOpGasLimit
+
+	return nil
+}
+
+// GetPaymasterData signs the user operation with its final gas limits and sets the paymaster data
+func (p *VerifyingPaymaster) GetPaymasterData(op *UserOperation) error {
+	var validUntil, validAfter uint64
+	if p.Config.ValidFor > 0 {
+		validUntil = uint64(time.Now().Add(p.Config.ValidFor).Unix())
+	}
+
+	if op.PaymasterVerificationGasLimit == nil {
+		op.PaymasterVerificationGasLimit = big.NewInt(0)
+	}
+	if op.PaymasterPostOpGasLimit == nil {
+		op.PaymasterPostOpGasLimit = big.NewInt(0)
+	}
+
+	hash, err := p.GetHash(op, validUntil, validAfter)
+	if err != nil {
+		return err
+	}
+
+	signature, err := p.Signer.SignHash(common.BytesToHash(accounts.TextHash(hash.Bytes())))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign verifying paymaster hash")
+	}
+
+	paymasterData, err := EncodeVerifyingPaymasterData(validUntil, validAfter, signature)
+	if err != nil {
+		return err
+	}
+
+	op.Paymaster = p.Config.Address.Bytes()
+	op.PaymasterData = paymasterData
+
+	return nil
+}
+
+func (p *VerifyingPaymaster) SponsorUserOperation(op *UserOperation) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationContext(context.Background(), op)
+}
+
+// SponsorUserOperationContext estimates the gas limits of the user operation with stub paymaster data and then signs it
+func (p *VerifyingPaymaster) SponsorUserOperationContext(ctx context.Context, op *UserOperation) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationWithOptionsContext(ctx, op, nil)
+}
+
+// SponsorUserOperationWithOptions is SponsorUserOperation with the gas limits of the options,
+// the VerifyingPaymaster has no gas policies and ignores the other options
+func (p *VerifyingPaymaster) SponsorUserOperationWithOptions(op *UserOperation, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	return p.SponsorUserOperationWithOptionsContext(context.Background(), op, options)
+}
+
+func (p *VerifyingPaymaster) SponsorUserOperationWithOptionsContext(ctx context.Context, op *UserOperation, options *SponsorshipOptions) (*SponsorUserOperationResponse, error) {
+	op.Signature = common.FromHex(SignatureDummy)
+
+	sponsoredOp := *op
+	if err := p.GetStubData(&sponsoredOp); err != nil {
+		return nil, err
+	}
+
+	gasEstimate, err := p.Bundler.EstimateUserOperationGasContext(ctx, &sponsoredOp)
+	if err != nil {
+		return nil, err
+	}
+
+	sponsoredOp.PreVerificationGas = gasEstimate.PreVerificationGas
+	sponsoredOp.VerificationGasLimit = gasEstimate.VerificationGasLimit
+	sponsoredOp.CallGasLimit = gasEstimate.CallGasLimit
+	if sponsoredOp.PaymasterVerificationGasLimit == nil {
+		sponsoredOp.PaymasterVerificationGasLimit = gasEstimate.PaymasterVerificationGasLimit
+	}
+	if sponsoredOp.PaymasterPostOpGasLimit == nil {
+		sponsoredOp.PaymasterPostOpGasLimit = gasEstimate.PaymasterPostOpGasLimit
+	}
+	if options != nil {
+		options.GasLimits.apply(&sponsoredOp)
+	}
+
+	if err := p.GetPaymasterData(&sponsoredOp); err != nil {
+		return nil, err
+	}
+
+	return &SponsorUserOperationResponse{
+		CallGasLimit:                  sponsoredOp.CallGasLimit,
+		PaymasterVerificationGasLimit: sponsoredOp.PaymasterVerificationGasLimit,
+		PaymasterPostOpGasLimit:       sponsoredOp.PaymasterPostOpGasLimit,
+		VerificationGasLimit:          sponsoredOp.VerificationGasLimit,
+		MaxPriorityFeePerGas:          sponsoredOp.MaxPriorityFeePerGas,
+		Paymaster:                     sponsoredOp.Paymaster,
+		MaxFeePerGas:                  sponsoredOp.MaxFeePerGas,
+		PaymasterData:                 sponsoredOp.PaymasterData,
+		PreVerificationGas:            sponsoredOp.PreVerificationGas,
+	}, nil
+}
+
+func bigIntBytes(value *big.Int) []byte {
+	if value == nil {
+		return nil
+	}
+	return value.Bytes()
+}
@@ -0,0 +1,81 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyingPaymaster_SponsorUserOperation(t *testing.T) {
+	paymasterAddress := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+	var estimatedOp *UserOperation
+	rpcClient := &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			require.Equal(t, "eth_estimateUserOperationGas", method)
+			estimatedOp = args[0].(*UserOperation)
+			return json.Unmarshal([]byte(`{"preVerificationGas":"0xd3e3","verificationGasLimit":"0x1079b","callGasLimit":"0x3f7e","paymasterVerificationGasLimit":"0x8000","paymasterPostOpGasLimit":"0x0"}`), result)
+		},
+	}
+
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	signer, err := NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	bundlerClient := newTestBundlerClient(t, rpcClient)
+	paymaster, err := NewVerifyingPaymaster(bundlerClient, bundlerClient.EntryPoint, bundlerClient.ChainID, signer, VerifyingPaymasterConfig{
+		Address:  paymasterAddress,
+		ValidFor: time.Hour,
+	})
+	require.NoError(t, err)
+
+	op := &UserOperation{
+		Sender:               common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"),
+		Nonce:                big.NewInt(1),
+		CallData:             common.FromHex("0x1234"),
+		MaxFeePerGas:         big.NewInt(2),
+		MaxPriorityFeePerGas: big.NewInt(1),
+	}
+	response, err := paymaster.SponsorUserOperation(op)
+	require.NoError(t, err)
+
+	// the estimation used the stub paymaster data
+	require.NotNil(t, estimatedOp)
+	assert.Equal(t, paymasterAddress.Bytes(), estimatedOp.Paymaster)
+	assert.Equal(t, verifyingPaymasterStubSignature, estimatedOp.PaymasterData[64:])
+
+	assert.Equal(t, paymasterAddress.Bytes(), response.Paymaster)
+	assert.Equal(t, big.NewInt(0x8000), response.PaymasterVerificationGasLimit)
+	require.Len(t, response.PaymasterData, 64+65)
+
+	validUntil := new(big.Int).SetBytes(response.PaymasterData[:32]).Uint64()
+	validAfter := new(big.Int).SetBytes(response.PaymasterData[32:64]).Uint64()
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), int64(validUntil), 5)
+	assert.Zero(t, validAfter)
+
+	sponsoredOp := *op
+	sponsoredOp.PreVerificationGas = response.PreVerificationGas
+	sponsoredOp.VerificationGasLimit = response.VerificationGasLimit
+	sponsoredOp.CallGasLimit = response.CallGasLimit
+	sponsoredOp.PaymasterVerificationGasLimit = response.PaymasterVerificationGasLimit
+	sponsoredOp.PaymasterPostOpGasLimit = response.PaymasterPostOpGasLimit
+
+	hash, err := paymaster.GetHash(&sponsoredOp, validUntil, validAfter)
+	require.NoError(t, err)
+
+	signature := append([]byte{}, response.PaymasterData[64:]...)
+	signature[64] -= 27
+	publicKey, err := crypto.SigToPub(accounts.TextHash(hash.Bytes()), signature)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.PubkeyToAddress(privateKey.PublicKey), crypto.PubkeyToAddress(*publicKey))
+}
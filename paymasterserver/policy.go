@@ -0,0 +1,225 @@
+package paymasterserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/DIMO-Network/go-zerodev"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// SponsorshipRequest is a user operation the server is asked to sponsor
+type SponsorshipRequest struct {
+	UserOperation *zerodev.UserOperation
+	// Context is the paymaster context sent by the client, e.g. a sponsorship policy id
+	Context map[string]interface{}
+	// MaxCost is the required prefund of the user operation in wei, the most the paymaster may pay for it
+	MaxCost *big.Int
+}
+
+// Policy decides whether a user operation is sponsored.
+// Check is called for stub paymaster data, Reserve for the final paymaster data. Reserve checks and counts the
+// sponsorship atomically, so concurrent requests cannot all pass the check before any of them is counted.
+// The returned rollback undoes the reservation when the paymaster data could not be signed.
+type Policy interface {
+	Check(ctx context.Context, request *SponsorshipRequest) error
+	Reserve(ctx context.Context, request *SponsorshipRequest) (rollback func(), err error)
+}
+
+// PolicyError rejects the sponsorship, it is answered with the JSON-RPC code of paymaster rejections
+type PolicyError struct {
+	Policy string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return "sponsorship rejected by " + e.Policy + " policy: " + e.Reason
+}
+
+func (e *PolicyError) ErrorCode() int {
+	return zerodev.RPCCodeRejectedByPaymaster
+}
+
+// SenderQuotaPolicy limits the number of sponsored user operations per sender within a fixed window
+type SenderQuotaPolicy struct {
+	Limit  int
+	Window time.Duration
+
+	mu      sync.Mutex
+	now     func() time.Time
+	windows map[common.Address]*quotaWindow
+}
+
+type quotaWindow struct {
+	start time.Time
+	count int
+}
+
+func NewSenderQuotaPolicy(limit int, window time.Duration) *SenderQuotaPolicy {
+	return &SenderQuotaPolicy{
+		Limit:   limit,
+		Window:  window,
+		now:     time.Now,
+		windows: make(map[common.Address]*quotaWindow),
+	}
+}
+
+func (p *SenderQuotaPolicy) Check(_ context.Context, request *SponsorshipRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.check(request.UserOperation.Sender, p.window(request.UserOperation.Sender))
+}
+
+func (p *SenderQuotaPolicy) Reserve(_ context.Context, request *SponsorshipRequest) (func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sender := request.UserOperation.Sender
+	window := p.window(sender)
+	if err := p.check(sender, window); err != nil {
+		return nil, err
+	}
+	window.count++
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		// a new window started meanwhile does not count the reservation
+		if p.windows[sender] == window && window.count > 0 {
+			window.count--
+		}
+	}, nil
+}
+
+func (p *SenderQuotaPolicy) check(sender common.Address, window *quotaWindow) error {
+	if window.count >= p.Limit {
+		return &PolicyError{Policy: "sender quota", Reason: fmt.Sprintf("%s reached %d user operations per %s", sender, p.Limit, p.Window)}
+	}
+	return nil
+}
+
+// window returns the current window of the sender, starting a new one when the previous expired
+func (p *SenderQuotaPolicy) window(sender common.Address) *quotaWindow {
+	now := p.now()
+
+	window, ok := p.windows[sender]
+	if !ok || now.Sub(window.start) >= p.Window {
+		window = &quotaWindow{start: now}
+		p.windows[sender] = window
+	}
+
+	return window
+}
+
+// TargetAllowlistPolicy sponsors only user operations calling allowed contracts.
+// The call data has to be Kernel execute call data, every call of a batch has to target an allowed contract.
+type TargetAllowlistPolicy struct {
+	Targets map[common.Address]struct{}
+}
+
+func NewTargetAllowlistPolicy(targets ...common.Address) *TargetAllowlistPolicy {
+	allowed := make(map[common.Address]struct{}, len(targets))
+	for _, target := range targets {
+		allowed[target] = struct{}{}
+	}
+
+	return &TargetAllowlistPolicy{
+		Targets: allowed,
+	}
+}
+
+func (p *TargetAllowlistPolicy) Check(_ context.Context, request *SponsorshipRequest) error {
+	calls, err := zerodev.DecodeExecuteCall(request.UserOperation.CallData)
+	if err != nil {
+		return &PolicyError{Policy: "target allowlist", Reason: err.Error()}
+	}
+
+	for _, call := range calls {
+		if call.To == nil {
+			return &PolicyError{Policy: "target allowlist", Reason: "contract creation is not allowed"}
+		}
+		if _, ok := p.Targets[*call.To]; !ok {
+			return &PolicyError{Policy: "target allowlist", Reason: call.To.String() + " is not allowed"}
+		}
+	}
+
+	return nil
+}
+
+func (p *TargetAllowlistPolicy) Reserve(ctx context.Context, request *SponsorshipRequest) (func(), error) {
+	if err := p.Check(ctx, request); err != nil {
+		return nil, err
+	}
+	return func() {}, nil
+}
+
+// DailyBudgetPolicy limits the sum of the maximal costs of sponsored user operations per UTC day
+type DailyBudgetPolicy struct {
+	// Budget in wei
+	Budget *big.Int
+
+	mu    sync.Mutex
+	now   func() time.Time
+	day   time.Time
+	spent *big.Int
+}
+
+func NewDailyBudgetPolicy(budget *big.Int) *DailyBudgetPolicy {
+	return &DailyBudgetPolicy{
+		Budget: budget,
+		now:    time.Now,
+		spent:  big.NewInt(0),
+	}
+}
+
+func (p *DailyBudgetPolicy) Check(_ context.Context, request *SponsorshipRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rollover()
+	return p.check(request.MaxCost)
+}
+
+func (p *DailyBudgetPolicy) Reserve(_ context.Context, request *SponsorshipRequest) (func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rollover()
+	if err := p.check(request.MaxCost); err != nil {
+		return nil, err
+	}
+
+	cost := new(big.Int).Set(request.MaxCost)
+	day := p.day
+	p.spent.Add(p.spent, cost)
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		// the budget of a new day does not include the reservation
+		if p.day.Equal(day) {
+			p.spent.Sub(p.spent, cost)
+		}
+	}, nil
+}
+
+func (p *DailyBudgetPolicy) check(cost *big.Int) error {
+	if new(big.Int).Add(p.spent, cost).Cmp(p.Budget) > 0 {
+		return &PolicyError{Policy: "daily budget", Reason: fmt.Sprintf("%s wei of %s wei spent today", p.spent, p.Budget)}
+	}
+	return nil
+}
+
+// rollover resets the spent amount when a new UTC day started
+func (p *DailyBudgetPolicy) rollover() {
+	day := p.now().UTC().Truncate(24 * time.Hour)
+	if !day.Equal(p.day) {
+		p.day = day
+		p.spent = big.NewInt(0)
+	}
+}
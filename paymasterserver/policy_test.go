@@ -0,0 +1,99 @@
+package paymasterserver
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/go-zerodev"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSenderQuotaPolicy(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := NewSenderQuotaPolicy(2, time.Hour)
+	policy.now = func() time.Time { return now }
+
+	request := &SponsorshipRequest{UserOperation: &zerodev.UserOperation{Sender: common.HexToAddress("0x01")}}
+	other := &SponsorshipRequest{UserOperation: &zerodev.UserOperation{Sender: common.HexToAddress("0x02")}}
+
+	for range 2 {
+		require.NoError(t, policy.Check(context.Background(), request))
+		_, err := policy.Reserve(context.Background(), request)
+		require.NoError(t, err)
+	}
+
+	var policyErr *PolicyError
+	assert.ErrorAs(t, policy.Check(context.Background(), request), &policyErr)
+	_, err := policy.Reserve(context.Background(), request)
+	assert.ErrorAs(t, err, &policyErr)
+	assert.NoError(t, policy.Check(context.Background(), other))
+
+	now = now.Add(time.Hour)
+	assert.NoError(t, policy.Check(context.Background(), request))
+}
+
+func TestDailyBudgetPolicy(t *testing.T) {
+	now := time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)
+	policy := NewDailyBudgetPolicy(big.NewInt(100))
+	policy.now = func() time.Time { return now }
+
+	request := &SponsorshipRequest{UserOperation: &zerodev.UserOperation{}, MaxCost: big.NewInt(60)}
+
+	require.NoError(t, policy.Check(context.Background(), request))
+	rollback, err := policy.Reserve(context.Background(), request)
+	require.NoError(t, err)
+
+	var policyErr *PolicyError
+	assert.ErrorAs(t, policy.Check(context.Background(), request), &policyErr)
+
+	// a rolled back reservation frees the budget
+	rollback()
+	_, err = policy.Reserve(context.Background(), request)
+	require.NoError(t, err)
+
+	now = now.Add(time.Hour)
+	assert.NoError(t, policy.Check(context.Background(), request))
+}
+
+func TestPolicies_ConcurrentReserve(t *testing.T) {
+	const requests = 50
+
+	quota := NewSenderQuotaPolicy(10, time.Hour)
+	budget := NewDailyBudgetPolicy(big.NewInt(300))
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		expected int64
+	}{
+		{name: "sender_quota", policy: quota, expected: 10},
+		{name: "daily_budget", policy: budget, expected: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &SponsorshipRequest{UserOperation: &zerodev.UserOperation{Sender: common.HexToAddress("0x01")}, MaxCost: big.NewInt(10)}
+
+			var reserved atomic.Int64
+			var wg sync.WaitGroup
+			for range requests {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := tt.policy.Reserve(context.Background(), request); err == nil {
+						reserved.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, tt.expected, reserved.Load())
+		})
+	}
+}
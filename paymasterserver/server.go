@@ -0,0 +1,249 @@
+package paymasterserver
+
+import (
+	"context"
+	"github.com/DIMO-Network/go-zerodev"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"net/http"
+)
+
+const (
+	defaultPaymasterVerificationGasLimit = 100_000
+	defaultPaymasterPostOpGasLimit       = 0
+)
+
+// InvalidParamsError is answered with the JSON-RPC invalid params code
+type InvalidParamsError struct {
+	Message string
+}
+
+func (e *InvalidParamsError) Error() string {
+	return e.Message
+}
+
+func (e *InvalidParamsError) ErrorCode() int {
+	return zerodev.RPCCodeInvalidUserOperation
+}
+
+// Server answers ERC-7677 pm_getPaymasterStubData and pm_getPaymasterData, and zd_sponsorUserOperation,
+// by signing the user operations with a VerifyingPaymaster key once all policies allow the sponsorship.
+// zd_sponsorUserOperation without shouldConsume only estimates the gas limits and returns stub paymaster data.
+type Server struct {
+	Paymaster *zerodev.VerifyingPaymaster
+	Policies  []Policy
+
+	rpcServer *rpc.Server
+}
+
+func NewServer(paymaster *zerodev.VerifyingPaymaster, policies ...Policy) (*Server, error) {
+	if paymaster == nil {
+		return nil, errors.New("paymaster is required")
+	}
+
+	server := &Server{
+		Paymaster: paymaster,
+		Policies:  policies,
+		rpcServer: rpc.NewServer(),
+	}
+
+	if err := server.rpcServer.RegisterName("pm", &pmService{server: server}); err != nil {
+		return nil, errors.Wrap(err, "failed to register pm namespace")
+	}
+
+	if err := server.rpcServer.RegisterName("zd", &zdService{server: server}); err != nil {
+		return nil, errors.Wrap(err, "failed to register zd namespace")
+	}
+
+	return server, nil
+}
+
+// ServeHTTP serves JSON-RPC over HTTP
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.rpcServer.ServeHTTP(w, r)
+}
+
+func (s *Server) Close() {
+	s.rpcServer.Stop()
+}
+
+// checkTarget validates the entry point and chain the client asks for
+func (s *Server) checkTarget(entryPoint common.Address, chainID *big.Int) error {
+	if entryPoint != s.Paymaster.EntryPoint.GetAddress() {
+		return &InvalidParamsError{Message: "unsupported entry point " + entryPoint.String()}
+	}
+
+	if chainID.Cmp(s.Paymaster.ChainID) != 0 {
+		return &InvalidParamsError{Message: "unsupported chain " + chainID.String()}
+	}
+
+	return nil
+}
+
+func (s *Server) check(ctx context.Context, request *SponsorshipRequest) error {
+	for _, policy := range s.Policies {
+		if err := policy.Check(ctx, request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserve reserves the sponsorship with all policies, the reservations already made are rolled back when one rejects it
+func (s *Server) reserve(ctx context.Context, request *SponsorshipRequest) (func(), error) {
+	rollbacks := make([]func(), 0, len(s.Policies))
+	rollback := func() {
+		for i := len(rollbacks) - 1; i >= 0; i-- {
+			rollbacks[i]()
+		}
+	}
+
+	for _, policy := range s.Policies {
+		policyRollback, err := policy.Reserve(ctx, request)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		rollbacks = append(rollbacks, policyRollback)
+	}
+
+	return rollback, nil
+}
+
+func newSponsorshipRequest(op *zerodev.UserOperation, paymasterContext map[string]interface{}) *SponsorshipRequest {
+	return &SponsorshipRequest{
+		UserOperation: op,
+		Context:       paymasterContext,
+		MaxCost:       op.RequiredPrefund(),
+	}
+}
+
+type pmService struct {
+	server *Server
+}
+
+// GetPaymasterStubData answers pm_getPaymasterStubData
+func (p *pmService) GetPaymasterStubData(ctx context.Context, op *zerodev.UserOperation, entryPoint common.Address, chainID hexutil.Big, paymasterContext map[string]interface{}) (*zerodev.GetPaymasterStubDataResponse, error) {
+	if err := p.server.checkTarget(entryPoint, chainID.ToInt()); err != nil {
+		return nil, err
+	}
+
+	stubOp := *op
+	if err := p.server.Paymaster.GetStubData(&stubOp); err != nil {
+		return nil, err
+	}
+
+	if stubOp.PaymasterVerificationGasLimit == nil {
+		stubOp.PaymasterVerificationGasLimit = big.NewInt(defaultPaymasterVerificationGasLimit)
+	}
+	if stubOp.PaymasterPostOpGasLimit == nil {
+		stubOp.PaymasterPostOpGasLimit = big.NewInt(defaultPaymasterPostOpGasLimit)
+	}
+
+	if err := p.server.check(ctx, newSponsorshipRequest(&stubOp, paymasterContext)); err != nil {
+		return nil, err
+	}
+
+	return &zerodev.GetPaymasterStubDataResponse{
+		Paymaster:                     stubOp.Paymaster,
+		PaymasterData:                 stubOp.PaymasterData,
+		PaymasterVerificationGasLimit: (*hexutil.Big)(stubOp.PaymasterVerificationGasLimit),
+		PaymasterPostOpGasLimit:       (*hexutil.Big)(stubOp.PaymasterPostOpGasLimit),
+	}, nil
+}
+
+// GetPaymasterData answers pm_getPaymasterData, the user operation has its final gas limits
+func (p *pmService) GetPaymasterData(ctx context.Context, op *zerodev.UserOperation, entryPoint common.Address, chainID hexutil.Big, paymasterContext map[string]interface{}) (*zerodev.GetPaymasterDataResponse, error) {
+	if err := p.server.checkTarget(entryPoint, chainID.ToInt()); err != nil {
+		return nil, err
+	}
+
+	sponsored := *op
+	rollback, err := p.server.reserve(ctx, newSponsorshipRequest(&sponsored, paymasterContext))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.server.Paymaster.GetPaymasterData(&sponsored); err != nil {
+		rollback()
+		return nil, err
+	}
+
+	return &zerodev.GetPaymasterDataResponse{
+		Paymaster:     sponsored.Paymaster,
+		PaymasterData: sponsored.PaymasterData,
+	}, nil
+}
+
+type zdService struct {
+	server *Server
+}
+
+// SponsorUserOperation answers zd_sponsorUserOperation, the gas limits are estimated with the bundler of the paymaster
+func (z *zdService) SponsorUserOperation(ctx context.Context, request zerodev.SponsorUserOperationRequest) (*zerodev.SponsorUserOperationResponse, error) {
+	if request.Operation == nil || request.ChainID == nil {
+		return nil, &InvalidParamsError{Message: "userOp and chainId are required"}
+	}
+
+	if err := z.server.checkTarget(request.EntryPointAddress, request.ChainID); err != nil {
+		return nil, err
+	}
+
+	if request.GasTokenData != nil {
+		return nil, &InvalidParamsError{Message: "paying gas in ERC-20 tokens is not supported"}
+	}
+
+	// policies see the gas limits of the sponsored user operation
+	sponsored := *request.Operation
+	response, err := z.server.Paymaster.SponsorUserOperationContext(ctx, &sponsored)
+	if err != nil {
+		return nil, err
+	}
+
+	sponsored.PreVerificationGas = response.PreVerificationGas
+	sponsored.VerificationGasLimit = response.VerificationGasLimit
+	sponsored.CallGasLimit = response.CallGasLimit
+	sponsored.PaymasterVerificationGasLimit = response.PaymasterVerificationGasLimit
+	sponsored.PaymasterPostOpGasLimit = response.PaymasterPostOpGasLimit
+
+	var paymasterContext map[string]interface{}
+	if request.SponsorshipPolicyID != "" || request.WebhookData != nil {
+		paymasterContext = map[string]interface{}{
+			"sponsorshipPolicyId": request.SponsorshipPolicyID,
+			"webhookData":         request.WebhookData,
+		}
+	}
+
+	// a sponsorship which is not consumed only estimates the gas limits, it gets stub paymaster data
+	// so that it cannot be sent around the policies
+	sponsorshipRequest := newSponsorshipRequest(&sponsored, paymasterContext)
+	if !request.ShouldConsume {
+		if err := z.server.check(ctx, sponsorshipRequest); err != nil {
+			return nil, err
+		}
+
+		stubOp := sponsored
+		if err := z.server.Paymaster.GetStubData(&stubOp); err != nil {
+			return nil, err
+		}
+		response.PaymasterData = stubOp.PaymasterData
+		return response, nil
+	}
+
+	rollback, err := z.server.reserve(ctx, sponsorshipRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	// signed again once reserved, so that only reserved sponsorships are signed
+	if err := z.server.Paymaster.GetPaymasterData(&sponsored); err != nil {
+		rollback()
+		return nil, err
+	}
+	response.PaymasterData = sponsored.PaymasterData
+
+	return response, nil
+}
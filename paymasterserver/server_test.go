@@ -0,0 +1,138 @@
+package paymasterserver
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/go-zerodev"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockBundlerRPC struct{}
+
+func (m *mockBundlerRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return json.Unmarshal([]byte(`{"preVerificationGas":"0xd3e3","verificationGasLimit":"0x1079b","callGasLimit":"0x3f7e","paymasterVerificationGasLimit":"0x8000","paymasterPostOpGasLimit":"0x0"}`), result)
+}
+
+func (m *mockBundlerRPC) Close() {}
+
+func newTestServer(t *testing.T, policies ...Policy) (*zerodev.BundlerClient, *rpc.Client) {
+	chainID := big.NewInt(zerodev.ChainPolygonAmoy)
+
+	entrypoint, err := zerodev.NewEntrypoint07(&mockBundlerRPC{}, chainID)
+	require.NoError(t, err)
+
+	bundlerClient, err := zerodev.NewBundlerClient(&mockBundlerRPC{}, entrypoint, chainID)
+	require.NoError(t, err)
+
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	signer, err := zerodev.NewPrivateKeySigner(privateKey)
+	require.NoError(t, err)
+
+	paymaster, err := zerodev.NewVerifyingPaymaster(bundlerClient, entrypoint, chainID, signer, zerodev.VerifyingPaymasterConfig{
+		Address: common.HexToAddress("0x00000000000000000000000000000000000000aa"),
+	})
+	require.NoError(t, err)
+
+	server, err := NewServer(paymaster, policies...)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	rpcClient, err := rpc.Dial(httpServer.URL)
+	require.NoError(t, err)
+	t.Cleanup(rpcClient.Close)
+
+	return bundlerClient, rpcClient
+}
+
+func newTestUserOperation(t *testing.T, target common.Address) *zerodev.UserOperation {
+	callData, err := zerodev.EncodeExecuteCall(&ethereum.CallMsg{To: &target, Value: big.NewInt(0), Data: common.FromHex("0x1234")})
+	require.NoError(t, err)
+
+	return &zerodev.UserOperation{
+		Sender:               common.HexToAddress("0xC81d8Fa063A7C73795C8455F6b766dd245D8F47A"),
+		Nonce:                big.NewInt(1),
+		CallData:             *callData,
+		MaxFeePerGas:         big.NewInt(2),
+		MaxPriorityFeePerGas: big.NewInt(1),
+	}
+}
+
+func TestServer_ERC7677(t *testing.T) {
+	target := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	bundlerClient, rpcClient := newTestServer(t, NewTargetAllowlistPolicy(target), NewSenderQuotaPolicy(1, time.Hour))
+
+	paymasterClient, err := zerodev.NewERC7677PaymasterClient(rpcClient, bundlerClient, bundlerClient.EntryPoint, bundlerClient.ChainID, nil)
+	require.NoError(t, err)
+
+	response, err := paymasterClient.SponsorUserOperation(newTestUserOperation(t, target))
+	require.NoError(t, err)
+
+	assert.Equal(t, common.HexToAddress("0x00000000000000000000000000000000000000aa").Bytes(), response.Paymaster)
+	assert.Len(t, response.PaymasterData, 64+65)
+	assert.Equal(t, big.NewInt(defaultPaymasterVerificationGasLimit), response.PaymasterVerificationGasLimit)
+
+	// the quota of the sender is used up
+	_, err = paymasterClient.SponsorUserOperation(newTestUserOperation(t, target))
+	assert.ErrorIs(t, err, zerodev.ErrRejectedByPaymaster)
+
+	// the target is not allowed
+	_, err = paymasterClient.SponsorUserOperation(newTestUserOperation(t, common.HexToAddress("0x00000000000000000000000000000000000000cc")))
+	assert.ErrorIs(t, err, zerodev.ErrRejectedByPaymaster)
+}
+
+func TestServer_ZeroDevSponsorUserOperation(t *testing.T) {
+	bundlerClient, rpcClient := newTestServer(t)
+
+	paymasterClient, err := zerodev.NewPaymasterClient(rpcClient, bundlerClient.EntryPoint, bundlerClient.ChainID)
+	require.NoError(t, err)
+
+	response, err := paymasterClient.SponsorUserOperation(newTestUserOperation(t, common.HexToAddress("0x00000000000000000000000000000000000000bb")))
+	require.NoError(t, err)
+
+	assert.Equal(t, big.NewInt(0x3f7e), response.CallGasLimit)
+	assert.Equal(t, big.NewInt(0x8000), response.PaymasterVerificationGasLimit)
+	assert.Len(t, response.PaymasterData, 64+65)
+}
+
+func TestServer_ZeroDevSponsorUserOperation_WithoutConsume(t *testing.T) {
+	// the budget allows a single sponsorship of the test user operation
+	bundlerClient, rpcClient := newTestServer(t, NewDailyBudgetPolicy(big.NewInt(400000)))
+
+	paymasterClient, err := zerodev.NewPaymasterClient(rpcClient, bundlerClient.EntryPoint, bundlerClient.ChainID)
+	require.NoError(t, err)
+
+	target := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	shouldConsume := false
+	for i := 0; i < 3; i++ {
+		response, err := paymasterClient.SponsorUserOperationWithOptions(newTestUserOperation(t, target), &zerodev.SponsorshipOptions{ShouldConsume: &shouldConsume})
+		require.NoError(t, err)
+
+		stubData, err := zerodev.EncodeVerifyingPaymasterData(0, 0, common.FromHex(zerodev.SignatureDummy))
+		require.NoError(t, err)
+		assert.Equal(t, stubData, response.PaymasterData)
+	}
+
+	response, err := paymasterClient.SponsorUserOperation(newTestUserOperation(t, target))
+	require.NoError(t, err)
+	assert.Len(t, response.PaymasterData, 64+65)
+	assert.NotEqual(t, common.FromHex(zerodev.SignatureDummy), response.PaymasterData[64:])
+
+	// the budget is used up
+	_, err = paymasterClient.SponsorUserOperation(newTestUserOperation(t, target))
+	assert.ErrorIs(t, err, zerodev.ErrRejectedByPaymaster)
+}
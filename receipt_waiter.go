@@ -0,0 +1,248 @@
+package zerodev
+
+import (
+	"context"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultReceiptInitialInterval = 500 * time.Millisecond
+	defaultReceiptMaxInterval     = 10 * time.Second
+	defaultReceiptMultiplier      = 1.5
+	defaultReceiptJitter          = 0.2
+	defaultReceiptTimeout         = 4 * time.Minute
+	defaultReceiptMaxFailures     = 5
+)
+
+// ReceiptWaiterConfig configures how ReceiptWaiter polls for receipts. Zero values are replaced with defaults.
+type ReceiptWaiterConfig struct {
+	// InitialInterval is the delay after the first unsuccessful poll, 500ms by default
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between polls, 10s by default
+	MaxInterval time.Duration
+	// Multiplier grows the delay after every unsuccessful poll, 1.5 by default
+	Multiplier float64
+	// Jitter randomizes every delay by up to this fraction of it, 0.2 by default
+	Jitter float64
+	// Timeout is the overall deadline for the receipt and the confirmations, 4 minutes by default
+	Timeout time.Duration
+	// Confirmations is the number of blocks required on top of the block including the user operation
+	Confirmations uint64
+	// WaitForFinalized requires the block including the user operation to be finalized
+	WaitForFinalized bool
+	// MaxConsecutiveFailures is the number of failed polls in a row after which waiting fails with the RPC error, 5 by default
+	MaxConsecutiveFailures int
+}
+
+// ReceiptWaiter waits for user operation receipts with exponential backoff and optionally for block confirmations.
+type ReceiptWaiter struct {
+	Bundler *BundlerClient
+	Network types.RPCClient
+	Config  ReceiptWaiterConfig
+}
+
+// NewReceiptWaiter creates a ReceiptWaiter, the network RPC client is only required for confirmations.
+func NewReceiptWaiter(bundler *BundlerClient, network types.RPCClient, config ReceiptWaiterConfig) (*ReceiptWaiter, error) {
+	if bundler == nil {
+		return nil, errors.New("bundler is required")
+	}
+
+	if network == nil && (config.Confirmations > 0 || config.WaitForFinalized) {
+		return nil, errors.New("network RPC client is required to wait for confirmations")
+	}
+
+	if config.InitialInterval <= 0 {
+		config.InitialInterval = defaultReceiptInitialInterval
+	}
+	if config.MaxInterval <= 0 {
+		config.MaxInterval = defaultReceiptMaxInterval
+	}
+	if config.Multiplier < 1 {
+		config.Multiplier = defaultReceiptMultiplier
+	}
+	if config.Jitter <= 0 || config.Jitter >= 1 {
+		config.Jitter = defaultReceiptJitter
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultReceiptTimeout
+	}
+	if config.MaxConsecutiveFailures <= 0 {
+		config.MaxConsecutiveFailures = defaultReceiptMaxFailures
+	}
+
+	return &ReceiptWaiter{
+		Bundler: bundler,
+		Network: network,
+		Config:  config,
+	}, nil
+}
+
+func (w *ReceiptWaiter) Wait(hash []byte) (*GetUserOperationReceiptResponse, error) {
+	return w.WaitContext(context.Background(), hash)
+}
+
+// WaitContext polls the bundler until the receipt is available and the required confirmations are reached.
+// The configured Timeout is applied on top of the deadline of the provided context.
+func (w *ReceiptWaiter) WaitContext(ctx context.Context, hash []byte) (*GetUserOperationReceiptResponse, error) {
+	receipt, _, err := w.WaitAnyContext(ctx, hash)
+	return receipt, err
+}
+
+// WaitAny waits for the receipt of the first included of the user operations, e.g. of a user operation and its replacement.
+// Returns the receipt and the index of the hash it belongs to.
+func (w *ReceiptWaiter) WaitAny(hashes ...[]byte) (*GetUserOperationReceiptResponse, int, error) {
+	return w.WaitAnyContext(context.Background(), hashes...)
+}
+
+// WaitAnyContext is WaitAny using the provided context, bounded by the configured timeout.
+func (w *ReceiptWaiter) WaitAnyContext(ctx context.Context, hashes ...[]byte) (*GetUserOperationReceiptResponse, int, error) {
+	if len(hashes) == 0 {
+		return nil, -1, errors.New("at least one user operation hash is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.Config.Timeout)
+	defer cancel()
+
+	var receipt *GetUserOperationReceiptResponse
+	var index, failures int
+	backoff := w.newBackoff()
+
+poll:
+	for {
+		for i, hash := range hashes {
+			var err error
+			receipt, err = w.Bundler.GetUserOperationReceiptContext(ctx, hash)
+			if err != nil {
+				// transient RPC failures are retried with the next poll
+				failures++
+				if ctx.Err() != nil {
+					return nil, -1, err
+				}
+				if failures >= w.Config.MaxConsecutiveFailures {
+					return nil, -1, errors.Wrapf(err, "failed to get receipt for user operation %s after %d consecutive failures", hexutil.Encode(hash), failures)
+				}
+				continue
+			}
+			failures = 0
+
+			if receipt != nil {
+				index = i
+				break poll
+			}
+		}
+
+		if err := backoff.sleep(ctx); err != nil {
+			return nil, -1, errors.Wrap(err, "failed to get receipt for user operation: "+hexutil.Encode(hashes[0]))
+		}
+	}
+
+	hash := hashes[index]
+
+	if w.Config.Confirmations == 0 && !w.Config.WaitForFinalized {
+		return receipt, index, nil
+	}
+
+	if receipt.Receipt.BlockNumber == nil {
+		return nil, -1, errors.New("receipt of user operation has no block number: " + hexutil.Encode(hash))
+	}
+
+	if err := w.waitForConfirmations(ctx, receipt.Receipt.BlockNumber.ToInt()); err != nil {
+		return receipt, index, errors.Wrap(err, "failed to confirm user operation: "+hexutil.Encode(hash))
+	}
+
+	return receipt, index, nil
+}
+
+func (w *ReceiptWaiter) waitForConfirmations(ctx context.Context, blockNumber *big.Int) error {
+	var failures int
+	backoff := w.newBackoff()
+
+	for {
+		confirmed, err := w.isConfirmed(ctx, blockNumber)
+		switch {
+		case err == nil && confirmed:
+			return nil
+		case err == nil:
+			failures = 0
+		case ctx.Err() != nil:
+			return err
+		default:
+			failures++
+			if failures >= w.Config.MaxConsecutiveFailures {
+				return errors.Wrapf(err, "failed to get confirmations after %d consecutive failures", failures)
+			}
+		}
+
+		if err := backoff.sleep(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *ReceiptWaiter) isConfirmed(ctx context.Context, blockNumber *big.Int) (bool, error) {
+	if w.Config.WaitForFinalized {
+		finalized, err := getBlockHeader(ctx, w.Network, BlockTagFinalized)
+		if err != nil {
+			return false, err
+		}
+		if finalized == nil || finalized.Number.ToInt().Cmp(blockNumber) < 0 {
+			return false, nil
+		}
+	}
+
+	if w.Config.Confirmations > 0 {
+		head, err := getBlockNumber(ctx, w.Network)
+		if err != nil {
+			return false, err
+		}
+
+		required := new(big.Int).Add(blockNumber, new(big.Int).SetUint64(w.Config.Confirmations))
+		if head.Cmp(required) < 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (w *ReceiptWaiter) newBackoff() *backoff {
+	return &backoff{
+		interval:   w.Config.InitialInterval,
+		max:        w.Config.MaxInterval,
+		multiplier: w.Config.Multiplier,
+		jitter:     w.Config.Jitter,
+	}
+}
+
+// backoff is an exponential backoff with jitter
+type backoff struct {
+	interval   time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+}
+
+// sleep waits for the current interval and grows it, returns early with the context error when the context is done
+func (b *backoff) sleep(ctx context.Context) error {
+	delay := time.Duration(float64(b.interval) * (1 + b.jitter*(2*rand.Float64()-1)))
+
+	b.interval = time.Duration(float64(b.interval) * b.multiplier)
+	if b.interval > b.max {
+		b.interval = b.max
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
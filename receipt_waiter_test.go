@@ -0,0 +1,126 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testReceipt = `{"userOpHash":"0x01","entrypoint":"0x0000000071727De22E5E9d8BAf0edAc6f37da032","sender":"0xc81d8fa063a7c73795c8455f6b766dd245d8f47a","nonce":"0x01","paymaster":"0x0000000000000000000000000000000000000000","actualGasUsed":"0x1","actualGasCost":"0x1","success":true,"logs":[],"receipt":{"blockNumber":"0x64","blockHash":"0xaa"}}`
+
+func TestReceiptWaiter_WaitContext(t *testing.T) {
+	var receiptCalls, blockNumberCalls atomic.Int32
+
+	rpcClient := &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			switch method {
+			case "eth_getUserOperationReceipt":
+				if receiptCalls.Add(1) < 3 {
+					return json.Unmarshal([]byte(`null`), result)
+				}
+				return json.Unmarshal([]byte(testReceipt), result)
+			case "eth_blockNumber":
+				// head moves one block per call: 0x65, 0x66, 0x67
+				head := 0x64 + blockNumberCalls.Add(1)
+				return json.Unmarshal([]byte(fmt.Sprintf(`"0x%x"`, head)), result)
+			}
+			return nil
+		},
+	}
+
+	waiter, err := NewReceiptWaiter(newTestBundlerClient(t, rpcClient), rpcClient, ReceiptWaiterConfig{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     2 * time.Millisecond,
+		Confirmations:   3,
+	})
+	require.NoError(t, err)
+
+	receipt, err := waiter.WaitContext(context.Background(), common.FromHex("0x01"))
+	require.NoError(t, err)
+	require.NotNil(t, receipt)
+
+	assert.Equal(t, int32(3), receiptCalls.Load())
+	assert.Equal(t, int32(3), blockNumberCalls.Load())
+}
+
+func TestReceiptWaiter_WaitContext_Cancelled(t *testing.T) {
+	rpcClient := jsonResponses(map[string]string{
+		"eth_getUserOperationReceipt": `null`,
+	})
+
+	waiter, err := NewReceiptWaiter(newTestBundlerClient(t, rpcClient), nil, ReceiptWaiterConfig{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = waiter.WaitContext(ctx, common.FromHex("0x01"))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestNewReceiptWaiter_RequiresNetworkForConfirmations(t *testing.T) {
+	_, err := NewReceiptWaiter(newTestBundlerClient(t, &mockRPCClient{}), nil, ReceiptWaiterConfig{WaitForFinalized: true})
+	assert.Error(t, err)
+}
+
+func TestReceiptWaiter_WaitContext_RPCFailures(t *testing.T) {
+	tests := []struct {
+		name          string
+		failedPolls   int32
+		expectedError bool
+	}{
+		{
+			name:        "flaky_poll",
+			failedPolls: 1,
+		},
+		{
+			name:          "consecutive_failures",
+			failedPolls:   3,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var receiptCalls atomic.Int32
+			rpcClient := &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					if receiptCalls.Add(1) <= tt.failedPolls {
+						return &jsonRPCError{code: -32603, message: "internal error"}
+					}
+					return json.Unmarshal([]byte(testReceipt), result)
+				},
+			}
+
+			waiter, err := NewReceiptWaiter(newTestBundlerClient(t, rpcClient), nil, ReceiptWaiterConfig{
+				InitialInterval:        time.Millisecond,
+				MaxInterval:            2 * time.Millisecond,
+				MaxConsecutiveFailures: 3,
+			})
+			require.NoError(t, err)
+
+			receipt, err := waiter.WaitContext(context.Background(), common.FromHex("0x01"))
+			if tt.expectedError {
+				var rpcErr *RPCError
+				assert.ErrorAs(t, err, &rpcErr)
+				assert.Nil(t, receipt)
+				assert.Equal(t, int32(3), receiptCalls.Load())
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, receipt)
+			assert.Equal(t, int32(2), receiptCalls.Load())
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package zerodev
+
+import (
+	"bytes"
+	"context"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"time"
+)
+
+const (
+	defaultReorgDepth        = 64
+	defaultReorgPollInterval = 2 * time.Second
+)
+
+type ReorgStatus string
+
+const (
+	// ReorgStatusCanonical the block including the user operation reached the configured depth and is still canonical
+	ReorgStatusCanonical ReorgStatus = "canonical"
+	// ReorgStatusReorgedOut the block including the user operation is no longer canonical and the user operation is not included in any other block
+	ReorgStatusReorgedOut ReorgStatus = "reorged_out"
+)
+
+// ReorgTrackerConfig configures ReorgTracker. Zero values are replaced with defaults.
+type ReorgTrackerConfig struct {
+	// Depth is the number of blocks on top of the including block after which a reorg is no longer expected, 64 by default
+	Depth uint64
+	// PollInterval is the delay between checks of the including block, 2s by default
+	PollInterval time.Duration
+}
+
+type ReorgTrackingResult struct {
+	Status ReorgStatus `json:"status"`
+	// Receipt is the latest known receipt, it differs from the tracked one when the user operation was re-included in another block
+	Receipt *GetUserOperationReceiptResponse `json:"receipt,omitempty"`
+	// Reincluded is true when the user operation was reorged out and included again in another block
+	Reincluded bool `json:"reincluded"`
+}
+
+// ReorgTracker re-verifies that the block including a user operation stays canonical until it reaches the configured depth.
+type ReorgTracker struct {
+	Bundler *BundlerClient
+	Network types.RPCClient
+	Config  ReorgTrackerConfig
+}
+
+func NewReorgTracker(bundler *BundlerClient, network types.RPCClient, config ReorgTrackerConfig) (*ReorgTracker, error) {
+	if bundler == nil || network == nil {
+		return nil, errors.New("bundler and network RPC client are required")
+	}
+
+	if config.Depth == 0 {
+		config.Depth = defaultReorgDepth
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultReorgPollInterval
+	}
+
+	return &ReorgTracker{
+		Bundler: bundler,
+		Network: network,
+		Config:  config,
+	}, nil
+}
+
+func (t *ReorgTracker) Track(receipt *GetUserOperationReceiptResponse) (*ReorgTrackingResult, error) {
+	return t.TrackContext(context.Background(), receipt)
+}
+
+// TrackContext blocks until the block including the user operation reaches the configured depth or is reorged out.
+// When the block is reorged out but the bundler reports the user operation in another canonical block, tracking continues with the new receipt.
+func (t *ReorgTracker) TrackContext(ctx context.Context, receipt *GetUserOperationReceiptResponse) (*ReorgTrackingResult, error) {
+	if receipt == nil || receipt.UserOpHash == nil || receipt.Receipt.BlockNumber == nil || receipt.Receipt.BlockHash == nil {
+		return nil, errors.New("receipt with user operation hash, block number and block hash is required")
+	}
+
+	result := &ReorgTrackingResult{
+		Receipt: receipt,
+	}
+
+	for {
+		canonical, err := t.isCanonical(ctx, result.Receipt)
+		if err != nil {
+			return nil, err
+		}
+
+		if !canonical {
+			latest, err := t.Bundler.GetUserOperationReceiptContext(ctx, *result.Receipt.UserOpHash)
+			if err != nil {
+				return nil, err
+			}
+
+			if latest == nil || latest.Receipt.BlockHash == nil || bytes.Equal(*latest.Receipt.BlockHash, *result.Receipt.Receipt.BlockHash) {
+				result.Status = ReorgStatusReorgedOut
+				return result, nil
+			}
+
+			result.Receipt = latest
+			result.Reincluded = true
+			continue
+		}
+
+		head, err := getBlockNumber(ctx, t.Network)
+		if err != nil {
+			return nil, err
+		}
+
+		required := new(big.Int).Add(result.Receipt.Receipt.BlockNumber.ToInt(), new(big.Int).SetUint64(t.Config.Depth))
+		if head.Cmp(required) >= 0 {
+			result.Status = ReorgStatusCanonical
+			return result, nil
+		}
+
+		timer := time.NewTimer(t.Config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, errors.Wrap(ctx.Err(), "failed to track user operation: "+hexutil.Encode(*result.Receipt.UserOpHash))
+		case <-timer.C:
+		}
+	}
+}
+
+// isCanonical checks that the block at the receipt's block number still has the receipt's block hash
+func (t *ReorgTracker) isCanonical(ctx context.Context, receipt *GetUserOperationReceiptResponse) (bool, error) {
+	header, err := getBlockHeader(ctx, t.Network, hexutil.EncodeBig(receipt.Receipt.BlockNumber.ToInt()))
+	if err != nil {
+		return false, err
+	}
+
+	return header != nil && bytes.Equal(header.Hash.Bytes(), *receipt.Receipt.BlockHash), nil
+}
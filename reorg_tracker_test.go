@@ -0,0 +1,78 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorgTracker_TrackContext(t *testing.T) {
+	reorgedBlockHash := common.HexToHash("0xaa")
+	canonicalBlockHash := common.HexToHash("0xbb")
+	reincludedReceipt := fmt.Sprintf(`{"userOpHash":"0x01","success":true,"logs":[],"receipt":{"blockNumber":"0x65","blockHash":"%s"}}`, canonicalBlockHash)
+
+	tests := []struct {
+		name               string
+		bundlerReceipt     string
+		expectedStatus     ReorgStatus
+		expectedReincluded bool
+	}{
+		{
+			name:               "reincluded_in_another_block",
+			bundlerReceipt:     reincludedReceipt,
+			expectedStatus:     ReorgStatusCanonical,
+			expectedReincluded: true,
+		},
+		{
+			name:           "reorged_out",
+			bundlerReceipt: `null`,
+			expectedStatus: ReorgStatusReorgedOut,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rpcClient := &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					switch method {
+					case "eth_getBlockByNumber":
+						// block 0x64 was replaced, block 0x65 is canonical
+						hash := reorgedBlockHash
+						if args[0] == "0x64" {
+							hash = common.HexToHash("0xcc")
+						} else if args[0] == "0x65" {
+							hash = canonicalBlockHash
+						}
+						return json.Unmarshal([]byte(fmt.Sprintf(`{"number":"%s","hash":"%s"}`, args[0], hash)), result)
+					case "eth_getUserOperationReceipt":
+						return json.Unmarshal([]byte(tt.bundlerReceipt), result)
+					case "eth_blockNumber":
+						return json.Unmarshal([]byte(`"0x70"`), result)
+					}
+					return nil
+				},
+			}
+
+			tracker, err := NewReorgTracker(newTestBundlerClient(t, rpcClient), rpcClient, ReorgTrackerConfig{
+				Depth:        10,
+				PollInterval: time.Millisecond,
+			})
+			require.NoError(t, err)
+
+			var receipt GetUserOperationReceiptResponse
+			require.NoError(t, json.Unmarshal([]byte(fmt.Sprintf(`{"userOpHash":"0x01","success":true,"logs":[],"receipt":{"blockNumber":"0x64","blockHash":"%s"}}`, reorgedBlockHash)), &receipt))
+
+			result, err := tracker.TrackContext(context.Background(), &receipt)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedStatus, result.Status)
+			assert.Equal(t, tt.expectedReincluded, result.Reincluded)
+		})
+	}
+}
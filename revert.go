@@ -0,0 +1,200 @@
+package zerodev
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/DIMO-Network/go-zerodev/abis"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/friendsofgo/errors"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var (
+	errorStringSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	panicSelector       = []byte{0x4e, 0x48, 0x7b, 0x71}
+)
+
+// maxRevertDepth limits decoding of reverts nested in bytes arguments, e.g. FailedOpWithRevert(uint256,string,bytes)
+const maxRevertDepth = 4
+
+// DefaultErrorRegistry knows the custom errors of the EntryPoint, Kernel and the ECDSA validator.
+// Register the ABIs of the contracts called by user operations to decode their custom errors as well.
+var DefaultErrorRegistry = NewErrorRegistry()
+
+func init() {
+	for _, definition := range []string{abis.EntryPoint07ErrorsAbi, abis.KernelErrorsAbi, abis.EcdsaValidatorErrorsAbi} {
+		if err := DefaultErrorRegistry.RegisterABI(definition); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// ErrorRegistry decodes revert data using the custom errors of registered ABIs, looked up by selector
+type ErrorRegistry struct {
+	mu     sync.RWMutex
+	errors map[[4]byte]abi.Error
+}
+
+func NewErrorRegistry() *ErrorRegistry {
+	return &ErrorRegistry{
+		errors: make(map[[4]byte]abi.Error),
+	}
+}
+
+// RegisterABI registers all custom errors of the JSON ABI
+func (r *ErrorRegistry) RegisterABI(definition string) error {
+	parsedAbi, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		return errors.Wrap(err, "failed to parse abi")
+	}
+
+	r.Register(&parsedAbi)
+	return nil
+}
+
+// Register registers all custom errors of the parsed ABI
+func (r *ErrorRegistry) Register(parsedAbi *abi.ABI) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, abiError := range parsedAbi.Errors {
+		var selector [4]byte
+		copy(selector[:], abiError.ID[:4])
+		r.errors[selector] = abiError
+	}
+}
+
+// DecodedRevert is revert data decoded as Error(string), Panic(uint256) or a registered custom error
+type DecodedRevert struct {
+	Data hexutil.Bytes `json:"data"`
+	// Name is "Error", "Panic" or the name of the custom error, empty when the selector is unknown
+	Name string `json:"name,omitempty"`
+	// Signature is the canonical signature of the error, e.g. FailedOp(uint256,string)
+	Signature string        `json:"signature,omitempty"`
+	Args      []interface{} `json:"args,omitempty"`
+	// PanicCode is the code of a Panic(uint256), e.g. 0x11 for an arithmetic underflow or overflow
+	PanicCode *big.Int `json:"panicCode,omitempty"`
+	// Inner is the revert nested in a bytes argument of the error, e.g. the inner revert of FailedOpWithRevert
+	Inner *DecodedRevert `json:"inner,omitempty"`
+}
+
+// Decode decodes the revert data, returns nil for empty data
+func (r *ErrorRegistry) Decode(data []byte) *DecodedRevert {
+	return r.decode(data, 0)
+}
+
+func (r *ErrorRegistry) decode(data []byte, depth int) *DecodedRevert {
+	if len(data) == 0 {
+		return nil
+	}
+
+	decoded := &DecodedRevert{
+		Data: data,
+	}
+
+	if len(data) < 4 {
+		return decoded
+	}
+
+	switch {
+	case bytes.Equal(data[:4], errorStringSelector), bytes.Equal(data[:4], panicSelector):
+		reason, err := abi.UnpackRevert(data)
+		if err != nil {
+			return decoded
+		}
+
+		decoded.Name = "Error"
+		decoded.Signature = "Error(string)"
+		if bytes.Equal(data[:4], panicSelector) {
+			decoded.Name = "Panic"
+			decoded.Signature = "Panic(uint256)"
+			decoded.PanicCode = new(big.Int).SetBytes(data[4:36])
+		}
+		decoded.Args = []interface{}{reason}
+
+		return decoded
+	}
+
+	var selector [4]byte
+	copy(selector[:], data[:4])
+
+	r.mu.RLock()
+	abiError, ok := r.errors[selector]
+	r.mu.RUnlock()
+
+	if !ok {
+		return decoded
+	}
+
+	unpacked, err := abiError.Inputs.Unpack(data[4:])
+	if err != nil {
+		return decoded
+	}
+
+	decoded.Name = abiError.Name
+	decoded.Signature = abiError.Sig
+	decoded.Args = unpacked
+
+	if depth < maxRevertDepth {
+		for _, arg := range unpacked {
+			if inner, ok := arg.([]byte); ok && len(inner) >= 4 {
+				decoded.Inner = r.decode(inner, depth+1)
+				break
+			}
+		}
+	}
+
+	return decoded
+}
+
+// String formats the decoded revert like Solidity, e.g. FailedOp(0, "AA23 reverted")
+func (d *DecodedRevert) String() string {
+	if d.Name == "" {
+		return "unknown revert " + d.Data.String()
+	}
+
+	args := make([]string, len(d.Args))
+	for i, arg := range d.Args {
+		switch value := arg.(type) {
+		case string:
+			args[i] = fmt.Sprintf("%q", value)
+		case []byte:
+			args[i] = hexutil.Encode(value)
+		case *big.Int:
+			args[i] = value.String()
+		default:
+			args[i] = fmt.Sprint(value)
+		}
+	}
+
+	formatted := d.Name + "(" + strings.Join(args, ", ") + ")"
+	if d.Inner != nil {
+		formatted += ": " + d.Inner.String()
+	}
+
+	return formatted
+}
+
+// revertDataFromErrorData extracts revert bytes from JSON-RPC error data, which bundlers and paymasters
+// return either as a hex string or as an object with the hex string in one of the well known fields
+func revertDataFromErrorData(data interface{}) []byte {
+	switch value := data.(type) {
+	case string:
+		decoded, err := hexutil.Decode(value)
+		if err != nil {
+			return nil
+		}
+		return decoded
+	case map[string]interface{}:
+		for _, key := range []string{"revertData", "data", "returnData", "inner"} {
+			if revertData := revertDataFromErrorData(value[key]); len(revertData) > 0 {
+				return revertData
+			}
+		}
+	}
+
+	return nil
+}
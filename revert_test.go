@@ -0,0 +1,127 @@
+package zerodev
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/DIMO-Network/go-zerodev/abis"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// packError encodes the custom error of the ABI like a contract reverting with it
+func packError(t *testing.T, definition string, name string, args ...interface{}) []byte {
+	parsedAbi, err := abi.JSON(strings.NewReader(definition))
+	require.NoError(t, err)
+
+	abiError := parsedAbi.Errors[name]
+	packed, err := abiError.Inputs.Pack(args...)
+	require.NoError(t, err)
+
+	return append(abiError.ID[:4:4], packed...)
+}
+
+func TestErrorRegistry_Decode(t *testing.T) {
+	const errorStringAbi = `[{"type":"error","name":"Error","inputs":[{"name":"reason","type":"string"}]}]`
+
+	tests := []struct {
+		name          string
+		data          []byte
+		expectedName  string
+		expectedInner string
+		expectedText  string
+		// expectedPanicCode is checked for all cases, nil for reverts other than Panic
+		expectedPanicCode *big.Int
+	}{
+		{
+			name:         "error_string",
+			data:         packError(t, errorStringAbi, "Error", "not allowed"),
+			expectedName: "Error",
+			expectedText: `Error("not allowed")`,
+		},
+		{
+			name:              "panic",
+			data:              common.FromHex("0x4e487b710000000000000000000000000000000000000000000000000000000000000011"),
+			expectedName:      "Panic",
+			expectedText:      `Panic("arithmetic underflow or overflow")`,
+			expectedPanicCode: big.NewInt(0x11),
+		},
+		{
+			name:         "entrypoint_failed_op",
+			data:         packError(t, abis.EntryPoint07ErrorsAbi, "FailedOp", big.NewInt(0), "AA23 reverted"),
+			expectedName: "FailedOp",
+			expectedText: `FailedOp(0, "AA23 reverted")`,
+		},
+		{
+			name: "nested_kernel_error",
+			data: packError(t, abis.EntryPoint07ErrorsAbi, "FailedOpWithRevert", big.NewInt(0), "AA23 reverted",
+				packError(t, abis.KernelErrorsAbi, "InvalidValidator")),
+			expectedName:  "FailedOpWithRevert",
+			expectedInner: "InvalidValidator",
+		},
+		{
+			name:         "unknown_selector",
+			data:         common.FromHex("0xdeadbeef"),
+			expectedText: "unknown revert 0xdeadbeef",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded := DefaultErrorRegistry.Decode(tt.data)
+			require.NotNil(t, decoded)
+
+			assert.Equal(t, tt.expectedName, decoded.Name)
+			assert.Equal(t, tt.expectedPanicCode, decoded.PanicCode)
+			if tt.expectedText != "" {
+				assert.Equal(t, tt.expectedText, decoded.String())
+			}
+			if tt.expectedInner != "" {
+				require.NotNil(t, decoded.Inner)
+				assert.Equal(t, tt.expectedInner, decoded.Inner.Name)
+			}
+		})
+	}
+
+	assert.Nil(t, DefaultErrorRegistry.Decode(nil))
+}
+
+func TestErrorRegistry_RegisterABI(t *testing.T) {
+	const tokenErrorsAbi = `[{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"}]}]`
+	data := packError(t, tokenErrorsAbi, "InsufficientBalance", big.NewInt(7))
+
+	registry := NewErrorRegistry()
+	assert.Empty(t, registry.Decode(data).Name)
+
+	require.NoError(t, registry.RegisterABI(tokenErrorsAbi))
+	assert.Equal(t, "InsufficientBalance(7)", registry.Decode(data).String())
+}
+
+func TestRPCError_Revert(t *testing.T) {
+	revertData := packError(t, abis.EntryPoint07ErrorsAbi, "FailedOp", big.NewInt(0), "AA33 reverted")
+
+	bundlerClient := newTestBundlerClient(t, &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			return &jsonRPCError{
+				code:    -32501,
+				message: "paymaster validation failed",
+				data:    map[string]interface{}{"revertData": hexutil.Encode(revertData)},
+			}
+		},
+	})
+
+	_, err := bundlerClient.SendUserOperation(&UserOperation{Sender: common.HexToAddress(AddressZero), Nonce: big.NewInt(0)})
+	require.Error(t, err)
+
+	var rpcErr *RPCError
+	require.ErrorAs(t, err, &rpcErr)
+	require.NotNil(t, rpcErr.Revert)
+	assert.Equal(t, "FailedOp", rpcErr.Revert.Name)
+	assert.Contains(t, err.Error(), `FailedOp(0, "AA33 reverted")`)
+	assert.ErrorIs(t, err, ErrAA33PaymasterReverted)
+}
@@ -0,0 +1,276 @@
+package zerodev
+
+import (
+	"context"
+	"github.com/DIMO-Network/go-zerodev/types"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/friendsofgo/errors"
+	"time"
+)
+
+const (
+	defaultTrackerPollInterval = time.Second
+	defaultTrackerDropTimeout  = 30 * time.Second
+	defaultTrackerMaxFailures  = 5
+)
+
+// statusRank orders the non-terminal statuses, a tracked user operation never moves back to a lower rank
+var statusRank = map[UserOperationStatus]int{
+	UserOperationStatusSubmitted: 1,
+	UserOperationStatusBundled:   2,
+	UserOperationStatusIncluded:  3,
+}
+
+// TrackerConfig configures Tracker. Zero values are replaced with defaults.
+type TrackerConfig struct {
+	// PollInterval is the delay between lookups of the user operation, 1s by default
+	PollInterval time.Duration
+	// DropTimeout is how long the bundler may not know the user operation before it is reported dropped, 30s by default
+	DropTimeout time.Duration
+	// MaxConsecutiveFailures is the number of failed polls in a row after which tracking fails with the RPC error, 5 by default
+	MaxConsecutiveFailures int
+	// TrackFinality waits for the block including the user operation to be finalized, which requires the finalized
+	// block tag of the network RPC. Included is the final status when false
+	TrackFinality bool
+}
+
+// UserOperationTransition is a status change observed by the Tracker
+type UserOperationTransition struct {
+	Status    UserOperationStatus `json:"status"`
+	Timestamp time.Time           `json:"timestamp"`
+	// TransactionHash is the bundle transaction, known from the bundled status on
+	TransactionHash *hexutil.Bytes `json:"transactionHash,omitempty"`
+	// Receipt is known from the included status on
+	Receipt *GetUserOperationReceiptResponse `json:"receipt,omitempty"`
+	// Err is set on the last transition of WatchContext when tracking failed, its Status is the last observed one
+	Err error `json:"-"`
+}
+
+// Tracker follows a user operation through its lifecycle by combining eth_getUserOperationByHash and eth_getUserOperationReceipt:
+// submitted (pending in mempool) -> bundled -> included -> finalized, or reverted / dropped.
+// Finality is only tracked with TrackerConfig.TrackFinality, otherwise included is the final status.
+type Tracker struct {
+	Bundler *BundlerClient
+	Network types.RPCClient
+	Config  TrackerConfig
+}
+
+func NewTracker(bundler *BundlerClient, network types.RPCClient, config TrackerConfig) (*Tracker, error) {
+	if bundler == nil {
+		return nil, errors.New("bundler is required")
+	}
+
+	if network == nil && config.TrackFinality {
+		return nil, errors.New("network RPC client is required to track finality")
+	}
+
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultTrackerPollInterval
+	}
+	if config.DropTimeout <= 0 {
+		config.DropTimeout = defaultTrackerDropTimeout
+	}
+	if config.MaxConsecutiveFailures <= 0 {
+		config.MaxConsecutiveFailures = defaultTrackerMaxFailures
+	}
+
+	return &Tracker{
+		Bundler: bundler,
+		Network: network,
+		Config:  config,
+	}, nil
+}
+
+func (t *Tracker) Wait(hash []byte) (*UserOperationResult, error) {
+	return t.WaitContext(context.Background(), hash)
+}
+
+// WaitContext blocks until the user operation reaches a final status.
+// For reverted and dropped user operations the result is returned together with a *UserOperationError.
+func (t *Tracker) WaitContext(ctx context.Context, hash []byte) (*UserOperationResult, error) {
+	result := &UserOperationResult{
+		UserOperationHash: hash,
+	}
+
+	err := t.track(ctx, hash, func(transition UserOperationTransition) bool {
+		result.Status = transition.Status
+		if transition.Receipt != nil {
+			result.Receipt = transition.Receipt
+		}
+		result.History = append(result.History, transition)
+		return true
+	})
+	if err != nil {
+		return result, &UserOperationError{
+			UserOperationHash: hash,
+			Status:            result.Status,
+			Err:               err,
+		}
+	}
+
+	switch result.Status {
+	case UserOperationStatusReverted:
+		return result, &UserOperationError{UserOperationHash: hash, Status: result.Status, Err: ErrUserOperationReverted}
+	case UserOperationStatusDropped:
+		return result, &UserOperationError{UserOperationHash: hash, Status: result.Status, Err: ErrUserOperationDropped}
+	}
+
+	return result, nil
+}
+
+// Watch is WatchContext without cancellation, the channel is closed once the user operation reaches a final status.
+func (t *Tracker) Watch(hash []byte) <-chan UserOperationTransition {
+	return t.WatchContext(context.Background(), hash)
+}
+
+// WatchContext streams the status transitions of the user operation.
+// The channel is closed once the user operation reaches a final status, the context is done or the RPC calls failed
+// MaxConsecutiveFailures times in a row. In the last case the last transition carries the error in Err.
+func (t *Tracker) WatchContext(ctx context.Context, hash []byte) <-chan UserOperationTransition {
+	transitions := make(chan UserOperationTransition, len(statusRank)+1)
+
+	go func() {
+		defer close(transitions)
+
+		var status UserOperationStatus
+		err := t.track(ctx, hash, func(transition UserOperationTransition) bool {
+			select {
+			case transitions <- transition:
+				status = transition.Status
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case transitions <- UserOperationTransition{Status: status, Timestamp: time.Now(), Err: err}:
+		case <-ctx.Done():
+		}
+	}()
+
+	return transitions
+}
+
+// track polls the bundler and emits every status change until a final status is reached, emit returning false stops tracking.
+// RPC failures are retried on the next poll until MaxConsecutiveFailures polls in a row failed.
+func (t *Tracker) track(ctx context.Context, hash []byte, emit func(UserOperationTransition) bool) error {
+	var status UserOperationStatus
+	var transactionHash *hexutil.Bytes
+	lastSeen := time.Now()
+
+	transition := func(next UserOperationStatus, receipt *GetUserOperationReceiptResponse) bool {
+		status = next
+		return emit(UserOperationTransition{
+			Status:          next,
+			Timestamp:       time.Now(),
+			TransactionHash: transactionHash,
+			Receipt:         receipt,
+		})
+	}
+
+	var failures int
+	for {
+		final, err := t.poll(ctx, hash, status, &lastSeen, &transactionHash, transition)
+		switch {
+		case err == nil && final:
+			return nil
+		case err == nil:
+			failures = 0
+		case ctx.Err() == nil:
+			failures++
+			if failures >= t.Config.MaxConsecutiveFailures {
+				return errors.Wrapf(err, "failed to track user operation %s after %d consecutive failures", hexutil.Encode(hash), failures)
+			}
+		}
+
+		timer := time.NewTimer(t.Config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrap(ctx.Err(), "failed to track user operation: "+hexutil.Encode(hash))
+		case <-timer.C:
+		}
+	}
+}
+
+// poll performs a single lookup and reports whether tracking is finished
+func (t *Tracker) poll(
+	ctx context.Context,
+	hash []byte,
+	status UserOperationStatus,
+	lastSeen *time.Time,
+	transactionHash **hexutil.Bytes,
+	transition func(UserOperationStatus, *GetUserOperationReceiptResponse) bool,
+) (bool, error) {
+	receipt, err := t.Bundler.GetUserOperationReceiptContext(ctx, hash)
+	if err != nil {
+		return false, err
+	}
+
+	if receipt != nil {
+		*transactionHash = receipt.Receipt.TransactionHash
+
+		if !receipt.Success {
+			transition(UserOperationStatusReverted, receipt)
+			return true, nil
+		}
+
+		if statusRank[status] < statusRank[UserOperationStatusIncluded] {
+			if !transition(UserOperationStatusIncluded, receipt) {
+				return true, nil
+			}
+		}
+
+		if !t.Config.TrackFinality {
+			return true, nil
+		}
+
+		finalized, err := getBlockHeader(ctx, t.Network, BlockTagFinalized)
+		if err != nil {
+			return false, err
+		}
+		if finalized == nil || receipt.Receipt.BlockNumber == nil {
+			return false, nil
+		}
+
+		if finalized.Number.ToInt().Cmp(receipt.Receipt.BlockNumber.ToInt()) >= 0 {
+			transition(UserOperationStatusFinalized, receipt)
+			return true, nil
+		}
+
+		return false, nil
+	}
+
+	operation, err := t.Bundler.GetUserOperationByHashContext(ctx, hash)
+	if err != nil {
+		return false, err
+	}
+
+	if operation == nil {
+		if time.Since(*lastSeen) >= t.Config.DropTimeout {
+			transition(UserOperationStatusDropped, nil)
+			return true, nil
+		}
+		return false, nil
+	}
+
+	*lastSeen = time.Now()
+
+	next := UserOperationStatusSubmitted
+	if operation.TransactionHash != nil {
+		*transactionHash = operation.TransactionHash
+		next = UserOperationStatusBundled
+	}
+
+	if statusRank[status] < statusRank[next] {
+		if !transition(next, nil) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,170 @@
+package zerodev
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lifecycleMock walks a user operation through submitted, bundled, included and finalized, one step per poll
+func lifecycleMock() *mockRPCClient {
+	var polls atomic.Int32
+
+	return &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			var response string
+			switch method {
+			case "eth_getUserOperationReceipt":
+				response = `null`
+				if polls.Add(1) >= 3 {
+					response = `{"userOpHash":"0x01","success":true,"logs":[],"receipt":{"transactionHash":"0xbb","blockNumber":"0x64"}}`
+				}
+			case "eth_getUserOperationByHash":
+				response = `{"userOperation":null}`
+				if polls.Load() >= 2 {
+					response = `{"userOperation":null,"transactionHash":"0xbb"}`
+				}
+			case "eth_getBlockByNumber":
+				response = `{"number":"0x63","hash":"0x0000000000000000000000000000000000000000000000000000000000000001"}`
+				if polls.Load() >= 5 {
+					response = `{"number":"0x64","hash":"0x0000000000000000000000000000000000000000000000000000000000000001"}`
+				}
+			}
+			return json.Unmarshal([]byte(response), result)
+		},
+	}
+}
+
+func TestTracker_WaitContext(t *testing.T) {
+	rpcClient := lifecycleMock()
+	tracker, err := NewTracker(newTestBundlerClient(t, rpcClient), rpcClient, TrackerConfig{PollInterval: time.Millisecond, TrackFinality: true})
+	require.NoError(t, err)
+
+	result, err := tracker.WaitContext(context.Background(), common.FromHex("0x01"))
+	require.NoError(t, err)
+
+	assert.Equal(t, UserOperationStatusFinalized, result.Status)
+	require.NotNil(t, result.Receipt)
+
+	var statuses []UserOperationStatus
+	for _, transition := range result.History {
+		statuses = append(statuses, transition.Status)
+	}
+	assert.Equal(t, []UserOperationStatus{
+		UserOperationStatusSubmitted,
+		UserOperationStatusBundled,
+		UserOperationStatusIncluded,
+		UserOperationStatusFinalized,
+	}, statuses)
+	assert.Equal(t, common.FromHex("0xbb"), []byte(*result.History[1].TransactionHash))
+}
+
+func TestTracker_WaitContext_WithoutFinality(t *testing.T) {
+	rpcClient := lifecycleMock()
+	tracker, err := NewTracker(newTestBundlerClient(t, rpcClient), rpcClient, TrackerConfig{PollInterval: time.Millisecond})
+	require.NoError(t, err)
+
+	result, err := tracker.WaitContext(context.Background(), common.FromHex("0x01"))
+	require.NoError(t, err)
+
+	assert.Equal(t, UserOperationStatusIncluded, result.Status)
+	require.Len(t, result.History, 3)
+}
+
+func TestTracker_WatchContext_Dropped(t *testing.T) {
+	rpcClient := jsonResponses(map[string]string{
+		"eth_getUserOperationReceipt": `null`,
+		"eth_getUserOperationByHash":  `null`,
+	})
+	tracker, err := NewTracker(newTestBundlerClient(t, rpcClient), nil, TrackerConfig{
+		PollInterval: time.Millisecond,
+		DropTimeout:  5 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	var transitions []UserOperationTransition
+	for transition := range tracker.WatchContext(context.Background(), common.FromHex("0x01")) {
+		transitions = append(transitions, transition)
+	}
+
+	require.Len(t, transitions, 1)
+	assert.Equal(t, UserOperationStatusDropped, transitions[0].Status)
+}
+
+func TestTracker_WaitContext_RPCFailures(t *testing.T) {
+	tests := []struct {
+		name           string
+		failingPolls   int32
+		expectedStatus UserOperationStatus
+		expectedErr    bool
+	}{
+		{
+			name:           "transient_failure",
+			failingPolls:   2,
+			expectedStatus: UserOperationStatusIncluded,
+		},
+		{
+			name:         "persistent_failure",
+			failingPolls: 100,
+			expectedErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls atomic.Int32
+			rpcClient := &mockRPCClient{
+				callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+					if polls.Add(1) <= tt.failingPolls {
+						return &jsonRPCError{code: -32601, message: "method not found"}
+					}
+					return json.Unmarshal([]byte(`{"userOpHash":"0x01","success":true,"logs":[],"receipt":{"transactionHash":"0xbb","blockNumber":"0x64"}}`), result)
+				},
+			}
+			tracker, err := NewTracker(newTestBundlerClient(t, rpcClient), nil, TrackerConfig{PollInterval: time.Millisecond, MaxConsecutiveFailures: 3})
+			require.NoError(t, err)
+
+			result, err := tracker.WaitContext(context.Background(), common.FromHex("0x01"))
+			if tt.expectedErr {
+				var rpcErr *RPCError
+				require.ErrorAs(t, err, &rpcErr)
+				assert.Equal(t, int32(3), polls.Load())
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, result.Status)
+		})
+	}
+}
+
+func TestTracker_WatchContext_RPCFailures(t *testing.T) {
+	rpcClient := &mockRPCClient{
+		callContextFunc: func(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+			return &jsonRPCError{code: -32601, message: "method not found"}
+		},
+	}
+	tracker, err := NewTracker(newTestBundlerClient(t, rpcClient), nil, TrackerConfig{PollInterval: time.Millisecond, MaxConsecutiveFailures: 2})
+	require.NoError(t, err)
+
+	var transitions []UserOperationTransition
+	for transition := range tracker.WatchContext(context.Background(), common.FromHex("0x01")) {
+		transitions = append(transitions, transition)
+	}
+
+	require.Len(t, transitions, 1)
+	var rpcErr *RPCError
+	assert.ErrorAs(t, transitions[0].Err, &rpcErr)
+	assert.Empty(t, transitions[0].Status)
+}
+
+func TestNewTracker_RequiresNetworkForFinality(t *testing.T) {
+	_, err := NewTracker(newTestBundlerClient(t, jsonResponses(nil)), nil, TrackerConfig{TrackFinality: true})
+	assert.Error(t, err)
+}
@@ -30,6 +30,29 @@ type UserOperation struct {
 	Signature                     []byte         `json:"signature,omitempty"`
 }
 
+// RequiredPrefund is the maximal gas cost of the user operation the EntryPoint collects upfront:
+// the sum of all gas limits multiplied by MaxFeePerGas
+func (op *UserOperation) RequiredPrefund() *big.Int {
+	requiredGas := big.NewInt(0)
+	for _, gas := range []*big.Int{
+		op.VerificationGasLimit,
+		op.CallGasLimit,
+		op.PaymasterVerificationGasLimit,
+		op.PaymasterPostOpGasLimit,
+		op.PreVerificationGas,
+	} {
+		if gas != nil {
+			requiredGas.Add(requiredGas, gas)
+		}
+	}
+
+	if op.MaxFeePerGas == nil {
+		return big.NewInt(0)
+	}
+
+	return requiredGas.Mul(requiredGas, op.MaxFeePerGas)
+}
+
 type UserOperationHex struct {
 	Sender                        string `json:"sender"`
 	Nonce                         string `json:"nonce"`